@@ -0,0 +1,25 @@
+package main
+
+import "regexp"
+
+// allowMarker matches the marker comment acknowledging a change as safe,
+// such as
+//
+//	k.fee = newFee //consensuswarn:allow the fee is not part of the state
+//
+// The text after the marker is the reason.
+var allowMarker = regexp.MustCompile(`//consensuswarn:allow(?:\s+(.*?))?\s*$`)
+
+// allowance returns the reason of the first allow marker on an added line of
+// h, and whether there is one.
+func (h *Hunk) allowance() (string, bool) {
+	for _, c := range h.changes {
+		if c.op != '+' {
+			continue
+		}
+		if m := allowMarker.FindStringSubmatch(c.text); m != nil {
+			return m[1], true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// fingerprint identifies the finding for h in baselines and posted comments.
+// It is derived from the touched function and the changed lines, and is thus
+// stable when unrelated changes shift the position of the hunk.
+func (h *Hunk) fingerprint() string {
+	sum := sha256.New()
+	fmt.Fprintf(sum, "%s\n", h.stack[len(h.stack)-1].fun.FullName())
+	for _, c := range h.changes {
+		fmt.Fprintf(sum, "%c%s\n", c.op, c.text)
+	}
+	return hex.EncodeToString(sum.Sum(nil)[:8])
+}
+
+// readBaseline reads the set of fingerprints from a baseline file. Each
+// line starts with a fingerprint; the rest of the line, empty lines and lines
+// starting with '#' are ignored.
+func readBaseline(path string) (map[string]bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	baseline := make(map[string]bool)
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		baseline[strings.Fields(line)[0]] = true
+	}
+	return baseline, s.Err()
+}
+
+// writeBaseline writes the fingerprints of hunks to a baseline file, each
+// followed by the location of its hunk for the benefit of human readers.
+func writeBaseline(path string, hunks []Hunk) error {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "# consensuswarn baseline\n")
+	for i := range hunks {
+		h := &hunks[i]
+		fmt.Fprintf(buf, "%s %s:%d\n", h.fingerprint(), h.relFile, h.startLine)
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// filterBaseline returns the hunks whose findings are not in baseline.
+func filterBaseline(hunks []Hunk, baseline map[string]bool) []Hunk {
+	var filtered []Hunk
+	for i := range hunks {
+		if !baseline[hunks[i].fingerprint()] {
+			filtered = append(filtered, hunks[i])
+		}
+	}
+	return filtered
+}
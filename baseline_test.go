@@ -0,0 +1,32 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestBaseline(t *testing.T) {
+	hunks := checkPatch(t, "testdata/state1.patch",
+		"github.com/orijtech/consensuswarn/testdata.RootFunc1",
+		"github.com/orijtech/consensuswarn/testdata.T.RootMethod1",
+	)
+	if len(hunks) != 2 {
+		t.Fatalf("expected 2 state changing hunks, got %d", len(hunks))
+	}
+	path := filepath.Join(t.TempDir(), "baseline")
+	// Baseline only the first finding.
+	if err := writeBaseline(path, hunks[:1]); err != nil {
+		t.Fatal(err)
+	}
+	baseline, err := readBaseline(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filtered := filterBaseline(hunks, baseline)
+	if len(filtered) != 1 {
+		t.Fatalf("expected 1 finding after baseline, got %d", len(filtered))
+	}
+	if filtered[0].startLine != hunks[1].startLine {
+		t.Errorf("baseline suppressed the wrong finding")
+	}
+}
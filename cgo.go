@@ -0,0 +1,39 @@
+package main
+
+import (
+	"go/ast"
+	"go/types"
+	"slices"
+	"strings"
+)
+
+// cgoName returns the name of the C function wrapped by f, such as C.add for
+// the _Cfunc_add wrapper generated by cgo, or the empty string if f is not a
+// cgo wrapper.
+func cgoName(f *types.Func) string {
+	for _, prefix := range []string{"_Cfunc_", "_C2func_"} {
+		if name, ok := strings.CutPrefix(f.Name(), prefix); ok {
+			return "C." + name
+		}
+	}
+	return ""
+}
+
+// cgoCalls returns the sorted names of the C functions called through cgo by
+// the body of inf. Native code is a risk for determinism and portability even
+// though its effects cannot be analyzed.
+func cgoCalls(inf BodyInfo) []string {
+	var names []string
+	ast.Inspect(inf.fun.Body, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok {
+			if f := calledFunc(inf.info, call); f != nil {
+				if name := cgoName(f); name != "" {
+					names = append(names, name)
+				}
+			}
+		}
+		return true
+	})
+	slices.Sort(names)
+	return slices.Compact(names)
+}
@@ -0,0 +1,49 @@
+//go:build cgo
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"go/token"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCgoCalls(t *testing.T) {
+	patch, err := os.ReadFile("testdata/cgo.patch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := new(token.FileSet)
+	res, err := runCheck(context.Background(), fset, cwd, bytes.NewReader(patch), []string{"github.com/orijtech/consensuswarn/testdata/cgo.Root"}, checkOptions{strict: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.hunks) != 1 {
+		t.Fatalf("expected 1 state changing hunk, got %d", len(res.hunks))
+	}
+	hunk := res.hunks[0]
+	if got := hunk.stack[len(hunk.stack)-1].fun.Name(); got != "update" {
+		t.Errorf("hunk touches %s, expected update", got)
+	}
+	if want := []string{"C.add"}; !reflect.DeepEqual(hunk.cgoCalls, want) {
+		t.Errorf("cgo calls %v, expected %v", hunk.cgoCalls, want)
+	}
+	if body, want := commentBody(fset, &hunk, 0), "calls the C functions `C.add` through cgo"; !strings.Contains(body, want) {
+		t.Errorf("comment\n%s\nlacks %q", body, want)
+	}
+	if len(res.blindSpots) != 1 {
+		t.Fatalf("expected 1 blind spot, got %d", len(res.blindSpots))
+	}
+	spot := res.blindSpots[0]
+	if spot.relFile != "testdata/cgo/cgo.go" || spot.pos.Line != 20 || spot.reason != "cgo call of C.add" {
+		t.Errorf("blind spot %s:%d: %s, expected testdata/cgo/cgo.go:20: cgo call of C.add", spot.relFile, spot.pos.Line, spot.reason)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"go/token"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// checkRunName is the name of the check runs of consensuswarn.
+const checkRunName = "consensuswarn"
+
+// maxAnnotations is the number of annotations accepted by each request of the
+// Checks API. Further annotations are added by updating the check run, which
+// appends them.
+const maxAnnotations = 50
+
+// checkRun is the payload creating or updating a check run.
+type checkRun struct {
+	Name       string         `json:"name,omitempty"`
+	HeadSHA    string         `json:"head_sha,omitempty"`
+	Status     string         `json:"status,omitempty"`
+	Conclusion string         `json:"conclusion,omitempty"`
+	Output     checkRunOutput `json:"output"`
+}
+
+type checkRunOutput struct {
+	Title       string            `json:"title"`
+	Summary     string            `json:"summary"`
+	Annotations []checkAnnotation `json:"annotations,omitempty"`
+}
+
+// checkAnnotation is an annotation of a check run on the changed lines of a
+// finding.
+type checkAnnotation struct {
+	Path            string `json:"path"`
+	StartLine       int    `json:"start_line"`
+	EndLine         int    `json:"end_line"`
+	AnnotationLevel string `json:"annotation_level"`
+	Title           string `json:"title"`
+	Message         string `json:"message"`
+}
+
+// postCheckRun reports the findings for hunks as a new check run of commit,
+// which supersedes the check runs of earlier checks of the commit rather than
+// updating them, because updates add to their annotations. The check run
+// fails if there are findings, and more than the
+// -fail-threshold if it is set. Creating check runs requires the token of a
+// GitHub App with the checks write permission.
+func postCheckRun(ctx context.Context, gh *github.Client, owner, repo, commit string, fset *token.FileSet, hunks []Hunk) error {
+	text := text()
+	run := &checkRun{
+		Name:       checkRunName,
+		HeadSHA:    commit,
+		Status:     "completed",
+		Conclusion: "success",
+		Output:     checkRunOutput{Title: text.NoFindings, Summary: text.NoFindings},
+	}
+	if len(hunks) > 0 {
+		run.Output = checkRunOutput{Title: text.Title, Summary: summaryTable(fset, hunks)}
+		if len(hunks) > *failThreshold {
+			run.Conclusion = "failure"
+		} else {
+			run.Conclusion = "neutral"
+		}
+	}
+	var annotations []checkAnnotation
+	for _, hunk := range hunks {
+		// The annotations are on the lines of the files at commit, the
+		// head of the diff, where deleted files have none.
+		if hunk.headRelFile == "/dev/null" {
+			continue
+		}
+		lines := headLines(hunk.hunk, cmp.Or(hunk.lastHunk, hunk.hunk))
+		annotations = append(annotations, checkAnnotation{
+			Path:            hunk.headRelFile,
+			StartLine:       lines[0],
+			EndLine:         lines[1],
+			AnnotationLevel: "warning",
+			Title:           hunk.stack[0].fun.FullName(),
+			Message:         annotationMessage(fset, &hunk),
+		})
+	}
+	var id int64
+	for first := true; first || len(annotations) > 0; first = false {
+		n := min(len(annotations), maxAnnotations)
+		run.Output.Annotations, annotations = annotations[:n], annotations[n:]
+		var err error
+		if first {
+			id, err = sendCheckRun(ctx, gh, "POST", apiEndpoint(gh, "repos/%s/%s/check-runs", owner, repo), run)
+		} else {
+			_, err = sendCheckRun(ctx, gh, "PATCH", apiEndpoint(gh, "repos/%s/%s/check-runs/%d", owner, repo, id), run)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// annotationMessage renders the comment of the finding for hunk as the plain
+// text of an annotation, without the code fences and code spans that
+// annotations do not render.
+func annotationMessage(fset *token.FileSet, hunk *Hunk) string {
+	var lines []string
+	for _, line := range strings.Split(commentBody(fset, hunk, *maxFrames), "\n") {
+		if line == "```" {
+			continue
+		}
+		lines = append(lines, strings.ReplaceAll(line, "`", ""))
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// sendCheckRun creates or updates a check run with run and returns its ID.
+func sendCheckRun(ctx context.Context, gh *github.Client, method, url string, run *checkRun) (int64, error) {
+	body, err := json.Marshal(run)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	if _, err := gh.Do(ctx, req, &created); err != nil {
+		return 0, err
+	}
+	return created.ID, nil
+}
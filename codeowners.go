@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// codeownersPaths are the locations of the CODEOWNERS file relative to the
+// base directory, in the order GitHub looks for them.
+var codeownersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+type ownerRule struct {
+	pattern ignoreRule
+	owners  []string
+}
+
+// codeOwners is the parsed content of a CODEOWNERS file. Its patterns follow
+// the .gitignore format without negation, and the last matching pattern
+// decides the owners of a path.
+type codeOwners []ownerRule
+
+// readCodeOwners reads the CODEOWNERS file from dir. A missing file results
+// in an empty list.
+func readCodeOwners(dir string) (codeOwners, error) {
+	for _, name := range codeownersPaths {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return parseCodeOwners(data), nil
+	}
+	return nil, nil
+}
+
+func parseCodeOwners(data []byte) codeOwners {
+	var c codeOwners
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		line, _, _ := strings.Cut(s.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		r, ok := parsePattern(fields[0])
+		if !ok {
+			continue
+		}
+		rule := ownerRule{pattern: r}
+		if len(fields) > 1 {
+			rule.owners = fields[1:]
+		}
+		c = append(c, rule)
+	}
+	return c
+}
+
+// owners returns the owners of the slash-separated path, relative to the base
+// directory. A matching pattern without owners leaves the path unowned.
+func (c codeOwners) owners(relPath string) []string {
+	elems := strings.Split(path.Clean(relPath), "/")
+	var owners []string
+	for _, r := range c {
+		if r.pattern.matchPath(elems) {
+			owners = r.owners
+		}
+	}
+	return owners
+}
+
+// annotate sets the owners of the files of hunks.
+func (c codeOwners) annotate(hunks []Hunk) {
+	for i := range hunks {
+		hunks[i].owners = c.owners(filepath.ToSlash(hunks[i].relFile))
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCodeOwnersMatch(t *testing.T) {
+	c := parseCodeOwners([]byte(`
+# Comment
+*                   @org/core
+x/bank/             @org/bank @alice # Inline comment
+x/**/simulation     @org/sim
+*_mock.go
+`))
+	tests := []struct {
+		path   string
+		owners []string
+	}{
+		{"app.go", []string{"@org/core"}},
+		{"x/bank/keeper/keeper.go", []string{"@org/bank", "@alice"}},
+		{"x/bank/simulation/sim.go", []string{"@org/sim"}},
+		{"x/bank/keeper/keeper_mock.go", nil},
+	}
+	for _, test := range tests {
+		if got := c.owners(test.path); !reflect.DeepEqual(got, test.owners) {
+			t.Errorf("owners(%q) = %q, expected %q", test.path, got, test.owners)
+		}
+	}
+}
+
+func TestCodeOwnersFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, ".github"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".github", "CODEOWNERS"), []byte("testdata/embediface/ @org/consensus\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := readCodeOwners(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hunks := checkPatch(t, "testdata/embediface.patch", "github.com/orijtech/consensuswarn/testdata/embediface.Root")
+	if len(hunks) != 1 {
+		t.Fatalf("expected 1 state changing hunk, got %d", len(hunks))
+	}
+	c.annotate(hunks)
+	if want := []string{"@org/consensus"}; !reflect.DeepEqual(hunks[0].owners, want) {
+		t.Errorf("owners %q, expected %q", hunks[0].owners, want)
+	}
+	fset := new(token.FileSet)
+	if body := commentBody(fset, &hunks[0], 0); !strings.Contains(body, "\nOwners: @org/consensus\n") {
+		t.Errorf("comment lacks the owners:\n%s", body)
+	}
+	if table, want := summaryTable(fset, hunks), "| File | Findings | Roots | Owners |\n| --- | --- | --- | --- |\n| `testdata/embediface/embediface.go` | 1 | `github.com/orijtech/consensuswarn/testdata/embediface.Root` | @org/consensus |\n"; !strings.Contains(table, want) {
+		t.Errorf("table\n%s\nlacks the owners roll-up\n%s", table, want)
+	}
+}
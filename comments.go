@@ -0,0 +1,137 @@
+package main
+
+import (
+	"go/scanner"
+	"go/token"
+	"os"
+	"strings"
+)
+
+// sourceLines classifies the lines of a Go source file by their tokens.
+type sourceLines struct {
+	// code is the set of lines holding a token other than a comment.
+	code map[int]bool
+	// comment is the set of lines holding part of a comment.
+	comment map[int]bool
+	// blocks are the first and last lines of the comments spanning several
+	// lines.
+	blocks [][2]int
+}
+
+// scanLines classifies the lines of src. It reports false if src does not
+// scan as Go source.
+func scanLines(src []byte) (sourceLines, bool) {
+	lines := sourceLines{code: make(map[int]bool), comment: make(map[int]bool)}
+	file := token.NewFileSet().AddFile("", -1, len(src))
+	ok := true
+	var s scanner.Scanner
+	s.Init(file, src, func(token.Position, string) { ok = false }, scanner.ScanComments)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.SEMICOLON && lit != ";" {
+			// Automatically inserted.
+			continue
+		}
+		start := file.Line(pos)
+		end := start
+		if lit != "" {
+			end = file.Line(pos + token.Pos(len(lit)) - 1)
+		}
+		for l := start; l <= end; l++ {
+			if tok == token.COMMENT {
+				lines.comment[l] = true
+			} else {
+				lines.code[l] = true
+			}
+		}
+		if tok == token.COMMENT && end > start {
+			lines.blocks = append(lines.blocks, [2]int{start, end})
+		}
+	}
+	return lines, ok
+}
+
+// scanTokens returns the Go tokens of src, each with its literal.
+func scanTokens(src string) []string {
+	file := token.NewFileSet().AddFile("", -1, len(src))
+	var s scanner.Scanner
+	s.Init(file, []byte(src), nil, scanner.ScanComments)
+	var tokens []string
+	for {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF {
+			return tokens
+		}
+		tokens = append(tokens, tok.String()+" "+lit)
+	}
+}
+
+// commentOnly reports whether line holds a comment and no code.
+func (s sourceLines) commentOnly(line int) bool {
+	return s.comment[line] && !s.code[line]
+}
+
+// inComment reports whether a line inserted before line is inside a comment
+// spanning several lines.
+func (s sourceLines) inComment(line int) bool {
+	for _, b := range s.blocks {
+		if b[0] < line && line <= b[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// markCommentOnly sets Hunk.commentOnly for the hunks of p that only change
+// comments and blank lines. The changed lines in the tree on disk, which are
+// the removed lines unless the hunks are remapped to the head of the patch,
+// are classified by the tokens of their file; the other lines by their own
+// tokens, unless they are inserted inside a comment of the tree.
+func (p Patch) markCommentOnly() {
+	files := make(map[string]sourceLines)
+	for i := range p {
+		h := &p[i]
+		base, ok := files[h.file]
+		if !ok {
+			src, err := os.ReadFile(h.file)
+			if err != nil {
+				continue
+			}
+			base, _ = scanLines(src)
+			files[h.file] = base
+		}
+		h.commentOnly = h.onlyComments(base)
+	}
+}
+
+// onlyComments reports whether the changes of h only touch comments and blank
+// lines of base, the classified lines of its file on disk.
+func (h *Hunk) onlyComments(base sourceLines) bool {
+	for i := 0; i < len(h.changes); {
+		c := h.changes[i]
+		if h.inTree(c) {
+			if strings.TrimSpace(c.text) != "" && !base.commentOnly(c.line) {
+				return false
+			}
+			i++
+			continue
+		}
+		// Scan a run of lines added at the same place together, to
+		// recognize comments spanning several lines.
+		var added []string
+		for ; i < len(h.changes) && !h.inTree(h.changes[i]) && h.changes[i].line == c.line; i++ {
+			added = append(added, h.changes[i].text)
+		}
+		if base.inComment(c.line) {
+			continue
+		}
+		lines, ok := scanLines([]byte(strings.Join(added, "\n") + "\n"))
+		if !ok || len(lines.code) > 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -1,15 +1,25 @@
 package main
 
 import (
+	"bytes"
+	"cmp"
+	"context"
 	"errors"
 	"fmt"
 	"go/ast"
 	"go/token"
 	"go/types"
 	"io"
+	"maps"
+	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/sourcegraph/go-diff/diff"
 	"golang.org/x/tools/go/packages"
@@ -27,107 +37,740 @@ type rootFunction struct {
 	fun string
 }
 
+// checkOptions configures runCheck.
+type checkOptions struct {
+	// reachability requests the reachable functions of every root in the
+	// result.
+	reachability bool
+	// logf, if not nil, receives debugging messages.
+	logf func(format string, args ...any)
+	// progressf, if not nil, receives progress messages.
+	progressf func(format string, args ...any)
+	// hooks lists the callback registration and extraction functions to
+	// follow.
+	hooks []hook
+	// excludeEdges are the calls excluded from the call graph.
+	excludeEdges []edge
+	// ignoreWhitespace drops the hunks that only change whitespace.
+	ignoreWhitespace bool
+	// minChangedLines drops the hunks with fewer added and removed lines.
+	minChangedLines int
+	// ignoreComments drops the hunks that only change comments.
+	ignoreComments bool
+	// strict reports the calls in reachable functions that cannot be
+	// resolved.
+	strict bool
+	// globals reports the package-level variables written by the changes.
+	globals bool
+	// reportUnreached additionally reports the hunks in the loaded Go files
+	// that touch no reachable function.
+	reportUnreached bool
+	// includeTestFiles reports hunks in _test.go files, which are dropped
+	// by default.
+	includeTestFiles bool
+	// resolvers are additional resolvers of the callees of calls.
+	resolvers []Resolver
+	// treeAtHead remaps the lines of the patch to dir, which holds the
+	// files at the head of the patch rather than at its base.
+	treeAtHead bool
+	// disabledRoots are the roots left out of the walk.
+	disabledRoots []rootFunction
+	// publicAPI lists the import paths of packages whose exported
+	// functions, and the exported methods of their exported types, are
+	// roots in addition to the named roots.
+	publicAPI []string
+	// allPackages loads every package under dir in addition to the
+	// packages of the roots, so that the changed symbols of the packages
+	// not imported by the roots are known.
+	allPackages bool
+	// everyRoot walks the functions reachable from each root separately to
+	// record every root reaching a hunk in Hunk.roots, rather than only
+	// the first.
+	everyRoot bool
+	// softTimeout, if positive, stops the walk of the roots when it has
+	// passed since the start of the check of a patch, and the findings
+	// gathered so far are returned as partial. Loading the packages does
+	// not count.
+	softTimeout time.Duration
+	// env holds KEY=VALUE variables added to the environment of the go
+	// command loading the packages, such as GOPRIVATE or GOFLAGS.
+	env []string
+}
+
+// loadEnv returns the environment of the go command loading the packages with
+// the additional variables of env, or nil to inherit the environment of the
+// process.
+func loadEnv(env []string) []string {
+	if len(env) == 0 {
+		return nil
+	}
+	return append(os.Environ(), env...)
+}
+
+// checkResult is the outcome of runCheck.
+type checkResult struct {
+	// roots are the resolved roots.
+	roots []*types.Func
+	// hunks are the hunks that touch reachable functions.
+	hunks []Hunk
+	// acknowledged are the hunks that touch reachable functions but carry
+	// an allow marker.
+	acknowledged []Hunk
+	// blindSpots are the unresolved calls in the reachable functions. They
+	// are only computed if checkOptions.strict is set.
+	blindSpots []blindSpot
+	// unreached are the hunks in the loaded Go files that touch no
+	// reachable function. They are only computed if
+	// checkOptions.reportUnreached is set.
+	unreached []Hunk
+	// reachable maps each root to the functions reachable from it, each
+	// mapped to a shortest call path from the root. It is only computed if
+	// checkOptions.reachability is set.
+	reachable map[*types.Func]map[*types.Func][]*types.Func
+	// partial reports that the walk of the roots stopped at the
+	// checkOptions.softTimeout, so some reachable hunks may be missing.
+	partial bool
+}
+
 // runCheck reports the patch hunks that touches any method or function reachable from
 // roots.
-func runCheck(fset *token.FileSet, dir string, patch io.Reader, roots []string) ([]Hunk, error) {
+func runCheck(ctx context.Context, fset *token.FileSet, dir string, patch io.Reader, roots []string, opts checkOptions) (*checkResult, error) {
+	prog, err := load(ctx, fset, dir, roots, opts)
+	if err != nil {
+		return nil, err
+	}
+	return prog.check(ctx, dir, patch, opts)
+}
+
+// program is the result of loading the packages and resolving the roots to
+// check.
+type program struct {
+	state *analyzerState
+	roots []*types.Func
+}
+
+// progressInterval is the number of packages between progress messages while
+// registering functions.
+const progressInterval = 100
+
+// progressHeartbeat is the interval between progress messages while loading
+// the packages, which reports nothing else until it is done.
+var progressHeartbeat = 10 * time.Second
+
+// heartbeat calls progressf with msg and the elapsed time every
+// progressHeartbeat until the returned function is called.
+func heartbeat(progressf func(format string, args ...any), msg string) (stop func()) {
+	start := time.Now()
+	ticker := time.NewTicker(progressHeartbeat)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-ticker.C:
+				progressf("%s for %s", msg, time.Since(start).Round(time.Second))
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+		wg.Wait()
+	}
+}
+
+// load loads the packages of roots from dir and resolves the roots. It
+// returns an error if a root is missing.
+func load(ctx context.Context, fset *token.FileSet, dir string, roots []string, opts checkOptions) (*program, error) {
 	cfg := &packages.Config{
-		Fset: fset,
-		Mode: packages.NeedImports | packages.NeedSyntax | packages.NeedDeps | packages.NeedName | packages.NeedTypes | packages.NeedTypesInfo,
+		Context: ctx,
+		Dir:     dir,
+		Env:     loadEnv(opts.env),
+		Fset:    fset,
+		Mode:    packages.NeedImports | packages.NeedSyntax | packages.NeedDeps | packages.NeedName | packages.NeedTypes | packages.NeedTypesInfo | packages.NeedFiles | packages.NeedCompiledGoFiles,
+	}
+	roots, err := expandShorthands(ctx, dir, roots, opts.env)
+	if err != nil {
+		return nil, err
 	}
 	var pkgPatterns []string
 	rootMap := make(map[rootFunction]bool)
-	for _, root := range roots {
-		var f rootFunction
-		lastSlash := strings.LastIndex(root, "/")
-		idx := strings.LastIndex(root, ".")
-		if idx <= lastSlash {
-			return nil, fmt.Errorf("malformed function or method: %s", root)
-		}
-		f.fun = root[idx+1:]
-		root = root[:idx]
-		f.typ = root
-		if idx := strings.LastIndex(root, "."); idx > lastSlash {
-			root = root[:idx]
-		}
-		pkgPatterns = append(pkgPatterns, "pattern="+root)
+	candidates := make([][]string, len(roots))
+	var ambiguous []string
+	for i, root := range roots {
+		f, pkgPaths, err := parseRoot(root)
+		if err != nil {
+			return nil, err
+		}
+		candidates[i] = pkgPaths
+		if len(pkgPaths) > 1 {
+			ambiguous = append(ambiguous, pkgPaths...)
+		}
 		rootMap[f] = true
 	}
+	var exists map[string]bool
+	if len(ambiguous) > 0 {
+		if exists, err = existingPackages(ctx, dir, ambiguous, opts.env); err != nil {
+			return nil, err
+		}
+	}
+	for i, pkgPaths := range candidates {
+		pkgPath, err := choosePackage(roots[i], pkgPaths, exists)
+		if err != nil {
+			return nil, err
+		}
+		pkgPatterns = append(pkgPatterns, "pattern="+pkgPath)
+	}
+	for _, pkgPath := range opts.publicAPI {
+		pkgPatterns = append(pkgPatterns, "pattern="+pkgPath)
+	}
+	if opts.allPackages {
+		pkgPatterns = append(pkgPatterns, "./...")
+	}
+	progressf := opts.progressf
+	if progressf == nil {
+		progressf = func(string, ...any) {}
+	}
+	progressf("loading the packages of %d roots", len(roots))
+	stop := heartbeat(progressf, "still loading the packages")
 	pkgs, err := packages.Load(cfg, pkgPatterns...)
+	stop()
 	if err != nil {
 		return nil, err
 	}
+	total := 0
+	packages.Visit(pkgs, nil, func(*packages.Package) { total++ })
+	progressf("loaded %d packages", total)
+	for _, pkg := range pkgs {
+		if pkg.Types != nil {
+			resolveAliases(pkg.Types, rootMap)
+		}
+	}
 	state := &analyzerState{
-		fset:  fset,
-		funcs: make(map[*types.Func]BodyInfo),
+		fset:     fset,
+		funcs:    make(map[*types.Func]BodyInfo),
+		files:    make(map[string]bool),
+		cgoFiles: make(map[string]bool),
+		logf:     opts.logf,
+	}
+	if state.logf == nil {
+		state.logf = func(string, ...any) {}
 	}
+	state.resolvers = append(state.builtinResolvers(), opts.resolvers...)
 	imported := make(map[*packages.Package]bool)
 	var rootFuncs []*types.Func
-	var addPkg func(pkg *packages.Package)
-	addPkg = func(pkg *packages.Package) {
+	var addPkg func(pkg *packages.Package) error
+	addPkg = func(pkg *packages.Package) error {
 		if imported[pkg] {
-			return
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
 		}
 		imported[pkg] = true
-		for _, f := range pkg.Syntax {
-			for _, decl := range f.Decls {
-				switch decl := decl.(type) {
-				case *ast.FuncDecl:
-					td := pkg.TypesInfo.Defs[decl.Name].(*types.Func)
-					inf := BodyInfo{decl, pkg.TypesInfo}
-					state.funcs[td] = inf
-					rf := rootFunction{fun: td.Name()}
-					if recv := td.Type().(*types.Signature).Recv(); recv != nil {
-						t := recv.Type()
-						if pt, isPointer := t.(*types.Pointer); isPointer {
-							t = pt.Elem()
-						}
-						rf.typ = types.TypeString(t, nil)
-					} else {
-						rf.typ = pkg.PkgPath
-					}
-					if rootMap[rf] {
-						delete(rootMap, rf)
-						rootFuncs = append(rootFuncs, td)
-					}
-				}
-			}
+		rootFuncs = append(rootFuncs, state.addPackage(pkg, rootMap)...)
+		if n := len(imported); n%progressInterval == 0 {
+			progressf("registered the functions of %d/%d packages", n, total)
 		}
 		for _, pkg := range pkg.Imports {
-			addPkg(pkg)
+			if err := addPkg(pkg); err != nil {
+				return err
+			}
 		}
+		return nil
 	}
 	for _, pkg := range pkgs {
 		if len(pkg.Errors) > 0 {
-			packages.PrintErrors(pkgs)
-			return nil, errors.New("failed to load packages")
+			loadErr := new(PackageLoadError)
+			packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+				loadErr.Errors = append(loadErr.Errors, pkg.Errors...)
+			})
+			return nil, loadErr
+		}
+		if err := addPkg(pkg); err != nil {
+			return nil, err
 		}
-		addPkg(pkg)
+	}
+	progressf("registered %d functions", len(state.funcs))
+	rootFuncs = appendNew(rootFuncs, state.interfaceRoots(pkgs, rootMap)...)
+	if len(opts.publicAPI) > 0 {
+		public, err := state.publicRoots(pkgs, opts.publicAPI)
+		if err != nil {
+			return nil, err
+		}
+		progressf("seeded %d roots from the public API", len(public))
+		rootFuncs = appendNew(rootFuncs, public...)
 	}
 	var missing []string
 	for n := range rootMap {
 		missing = append(missing, n.typ+"."+n.fun)
 	}
 	if len(missing) > 0 {
-		return nil, fmt.Errorf("missing roots: %v", strings.Join(missing, ","))
+		sort.Strings(missing)
+		return nil, &MissingRootsError{Roots: missing}
+	}
+	if len(opts.hooks) > 0 {
+		state.collectHooks(opts.hooks)
+	}
+	if len(opts.excludeEdges) > 0 {
+		state.excludedEdges = make(map[edge]bool)
+		for _, e := range opts.excludeEdges {
+			state.excludedEdges[e] = true
+		}
+	}
+	state.collectFieldFuncs()
+	state.collectPinnedTypes()
+	state.linkFuncs()
+	return &program{state: state, roots: rootFuncs}, nil
+}
+
+// parseRoot parses a function or method specification and returns it along
+// with the candidate paths of its package. The last element of the package
+// path may contain dots, so a specification such as
+//
+//	gopkg.in/foo.v2.T.M
+//
+// denotes either method M of type T in package gopkg.in/foo.v2, or function
+// M in package gopkg.in/foo.v2.T. The method interpretation comes first.
+func parseRoot(root string) (rootFunction, []string, error) {
+	lastSlash := strings.LastIndex(root, "/")
+	idx := strings.LastIndex(root, ".")
+	if idx <= lastSlash+1 || idx == len(root)-1 {
+		return rootFunction{}, nil, &MalformedRootError{Root: root}
+	}
+	f := rootFunction{typ: root[:idx], fun: root[idx+1:]}
+	var pkgPaths []string
+	if idx := strings.LastIndex(f.typ, "."); idx > lastSlash+1 {
+		pkgPaths = append(pkgPaths, f.typ[:idx])
+	}
+	pkgPaths = append(pkgPaths, f.typ)
+	return f, pkgPaths, nil
+}
+
+// existingPackages returns the set of pkgPaths that denote packages loadable
+// from dir.
+func existingPackages(ctx context.Context, dir string, pkgPaths, env []string) (map[string]bool, error) {
+	cfg := &packages.Config{Context: ctx, Dir: dir, Env: loadEnv(env), Mode: packages.NeedName | packages.NeedFiles}
+	patterns := make([]string, len(pkgPaths))
+	for i, p := range pkgPaths {
+		patterns[i] = "pattern=" + p
+	}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	exists := make(map[string]bool)
+	for _, pkg := range pkgs {
+		if len(pkg.Errors) == 0 && len(pkg.GoFiles) > 0 {
+			exists[pkg.PkgPath] = true
+		}
+	}
+	return exists, nil
+}
+
+// choosePackage returns the candidate package path of root that exists. If
+// none does, the first candidate is returned for the loader to report.
+func choosePackage(root string, pkgPaths []string, exists map[string]bool) (string, error) {
+	if len(pkgPaths) == 1 {
+		return pkgPaths[0], nil
+	}
+	var found []string
+	for _, p := range pkgPaths {
+		if exists[p] {
+			found = append(found, p)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return pkgPaths[0], nil
+	case 1:
+		return found[0], nil
+	default:
+		return "", fmt.Errorf("ambiguous root %s: packages %s both exist", root, strings.Join(found, " and "))
+	}
+}
+
+// rootFunctionOf returns the specification of the function or method f. The
+// receiver types of methods of generic types are named without their type
+// parameters.
+func rootFunctionOf(f *types.Func) rootFunction {
+	rf := rootFunction{fun: f.Name()}
+	if recv := f.Type().(*types.Signature).Recv(); recv != nil {
+		t := recv.Type()
+		if pt, isPointer := t.(*types.Pointer); isPointer {
+			t = pt.Elem()
+		}
+		if named, ok := t.(*types.Named); ok && named.TypeArgs().Len() > 0 && named.Obj().Pkg() != nil {
+			rf.typ = named.Obj().Pkg().Path() + "." + named.Obj().Name()
+			return rf
+		}
+		rf.typ = types.TypeString(t, nil)
+	} else if f.Pkg() != nil {
+		rf.typ = f.Pkg().Path()
+	}
+	return rf
+}
+
+// check reports the patch hunks relative to dir that touch any function
+// reachable from the roots of prog.
+func (prog *program) check(ctx context.Context, dir string, patch io.Reader, opts checkOptions) (*checkResult, error) {
+	start := time.Now()
+	state := prog.state
+	res := &checkResult{roots: prog.enabledRoots(opts)}
+	if opts.reachability {
+		res.reachable = make(map[*types.Func]map[*types.Func][]*types.Func)
+		for _, root := range res.roots {
+			paths, err := state.reachable(ctx, root)
+			if err != nil {
+				return nil, err
+			}
+			res.reachable[root] = paths
+		}
 	}
 	p, err := parsePatch(dir, patch)
 	if err != nil {
 		return nil, err
 	}
-	for _, root := range rootFuncs {
-		inspect(state, p, root, nil)
+	if opts.treeAtHead {
+		p.remapToHead(dir)
+	}
+	walkCtx := ctx
+	if opts.softTimeout > 0 {
+		var cancel context.CancelFunc
+		walkCtx, cancel = context.WithDeadline(ctx, start.Add(opts.softTimeout))
+		defer cancel()
+	}
+	visited := make(map[*types.Func]bool)
+	for i, root := range res.roots {
+		walked := visited
+		if opts.everyRoot {
+			walked = make(map[*types.Func]bool)
+		}
+		if err := inspect(walkCtx, state, p, root, nil, walked); err != nil {
+			// Unlike the cancellation of ctx, the soft timeout keeps
+			// the findings so far.
+			if ctx.Err() != nil || walkCtx.Err() == nil {
+				return nil, err
+			}
+			if opts.logf != nil {
+				opts.logf("soft timeout passed while walking root %d/%d: %s", i+1, len(res.roots), root.FullName())
+			}
+			res.partial = true
+		}
+		if opts.everyRoot {
+			maps.Copy(visited, walked)
+		}
+		if res.partial {
+			break
+		}
+		if opts.progressf != nil {
+			opts.progressf("walked root %d/%d: %s", i+1, len(res.roots), root.FullName())
+		}
+	}
+	if opts.strict {
+		res.blindSpots = state.blindSpots(dir, visited)
+	}
+	for i := range p {
+		if h := &p[i]; len(h.stack) > 0 {
+			inf := state.funcs[h.stack[len(h.stack)-1].fun]
+			if opts.globals {
+				h.globals = state.globalWrites(h, inf)
+			}
+			h.cgoCalls = cgoCalls(inf)
+		}
+	}
+	if opts.ignoreComments {
+		p.markCommentOnly()
 	}
-	var stateHunks []Hunk
+	res.hunks, res.acknowledged = p.findings(opts)
+	if opts.reportUnreached {
+		res.unreached = p.unreached(state.files, opts)
+	}
+	return res, nil
+}
+
+// enabledRoots returns the roots of prog that are not disabled by opts.
+func (prog *program) enabledRoots(opts checkOptions) []*types.Func {
+	if len(opts.disabledRoots) == 0 {
+		return prog.roots
+	}
+	var roots []*types.Func
+	disabled := make(map[rootFunction]bool)
+	for _, root := range prog.roots {
+		f := rootFunctionOf(root)
+		if slices.Contains(opts.disabledRoots, f) {
+			disabled[f] = true
+			continue
+		}
+		roots = append(roots, root)
+	}
+	for _, f := range opts.disabledRoots {
+		if !disabled[f] && opts.logf != nil {
+			opts.logf("disabled root %s.%s matches no root", f.typ, f.fun)
+		}
+	}
+	return roots
+}
+
+// reachableFiles returns the sorted, slash-separated paths relative to dir of
+// the files in dir that declare a function reachable from the roots of prog
+// enabled by opts.
+func (prog *program) reachableFiles(ctx context.Context, dir string, opts checkOptions) ([]string, error) {
+	visited := make(map[*types.Func]bool)
+	for _, root := range prog.enabledRoots(opts) {
+		// Nothing is marked in an empty patch.
+		if err := inspect(ctx, prog.state, nil, root, nil, visited); err != nil {
+			return nil, err
+		}
+	}
+	var files []string
+	for f := range visited {
+		rel, err := filepath.Rel(dir, prog.state.fset.Position(prog.state.funcs[f].fun.Pos()).Filename)
+		if err != nil || !filepath.IsLocal(rel) {
+			continue
+		}
+		files = append(files, filepath.ToSlash(rel))
+	}
+	slices.Sort(files)
+	return slices.Compact(files), nil
+}
+
+// unreached returns the unmarked hunks of p in files.
+func (p Patch) unreached(files map[string]bool, opts checkOptions) []Hunk {
+	var hunks []Hunk
 	for _, hunk := range p {
-		if len(hunk.stack) > 0 {
-			stateHunks = append(stateHunks, hunk)
+		if len(hunk.stack) > 0 || !files[hunk.file] || !hunk.reported(opts) {
+			continue
 		}
+		hunks = append(hunks, hunk)
 	}
-	return stateHunks, nil
+	return hunks
+}
+
+// reported reports whether h is reported according to opts, whether it is
+// reachable or not: it is not filtered out as a change of a test file, a
+// whitespace-only or comment-only change, or a change of too few lines.
+func (h *Hunk) reported(opts checkOptions) bool {
+	if !opts.includeTestFiles && strings.HasSuffix(h.relFile, "_test.go") {
+		return false
+	}
+	if opts.ignoreWhitespace && h.whitespaceOnly() {
+		return false
+	}
+	if len(h.changes) < opts.minChangedLines {
+		return false
+	}
+	return !opts.ignoreComments || !h.commentOnly
+}
+
+// changesGo reports whether a hunk of p changes a Go file that may be
+// reported according to opts, at the base or, for added files, at the head of
+// the patch.
+func (p Patch) changesGo(opts checkOptions) bool {
+	for _, hunk := range p {
+		for _, name := range []string{hunk.relFile, hunk.headRelFile} {
+			if !strings.HasSuffix(name, ".go") {
+				continue
+			}
+			if opts.includeTestFiles || !strings.HasSuffix(name, "_test.go") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// findings returns the marked hunks of p that are reported according to
+// opts, and separately those acknowledged by an allow marker. Hunks that touch
+// the same function are merged into a single finding.
+func (p Patch) findings(opts checkOptions) (hunks, acknowledged []Hunk) {
+	for _, hunk := range p {
+		if len(hunk.stack) == 0 || !hunk.reported(opts) {
+			continue
+		}
+		if reason, ok := hunk.allowance(); ok {
+			hunk.reason = reason
+			acknowledged = append(acknowledged, hunk)
+			continue
+		}
+		if n := len(hunks); n > 0 && hunks[n-1].sameFunc(&hunk) {
+			hunks[n-1].merge(&hunk)
+			continue
+		}
+		hunks = append(hunks, hunk)
+	}
+	return hunks, acknowledged
+}
+
+// sortHunks sorts hunks by file, start line and the name of the root of their
+// call sequence, so that the reports do not depend on the order of the walk.
+func sortHunks(hunks []Hunk) {
+	sort.SliceStable(hunks, func(i, j int) bool {
+		h1, h2 := &hunks[i], &hunks[j]
+		if h1.file != h2.file {
+			return h1.file < h2.file
+		}
+		if h1.startLine != h2.startLine {
+			return h1.startLine < h2.startLine
+		}
+		return h1.rootName() < h2.rootName()
+	})
+}
+
+// rootName returns the full name of the root of the call sequence of h, or
+// the empty string if h is not reachable.
+func (h *Hunk) rootName() string {
+	if len(h.stack) == 0 {
+		return ""
+	}
+	return h.stack[0].fun.FullName()
+}
+
+// expandShorthands replaces the roots that omit the package path, such as
+//
+//	keeper.Keeper.Method
+//
+// with the full path of the package of that name in the module of dir. The
+// roots whose first element names no package of the module are import paths,
+// such as sort.Sort of the standard library or a root of a module with a
+// single-element path. It is an error if several packages have the name.
+func expandShorthands(ctx context.Context, dir string, roots, env []string) ([]string, error) {
+	var pkgs []*packages.Package
+	expanded := make([]string, len(roots))
+	for i, root := range roots {
+		name, rest, ok := strings.Cut(root, ".")
+		if !ok || strings.Contains(root, "/") {
+			expanded[i] = root
+			continue
+		}
+		if pkgs == nil {
+			cfg := &packages.Config{Context: ctx, Dir: dir, Env: loadEnv(env), Mode: packages.NeedName}
+			var err error
+			pkgs, err = packages.Load(cfg, "./...")
+			if err != nil {
+				return nil, err
+			}
+		}
+		var paths []string
+		for _, pkg := range pkgs {
+			if pkg.Name == name {
+				paths = append(paths, pkg.PkgPath)
+			}
+		}
+		switch len(paths) {
+		case 0:
+			expanded[i] = root
+		case 1:
+			expanded[i] = paths[0] + "." + rest
+		default:
+			return nil, fmt.Errorf("ambiguous root %s: packages %s are named %s", root, strings.Join(paths, ", "), name)
+		}
+	}
+	return expanded, nil
+}
+
+// resolveAliases rewrites the method roots in pkg whose type is an alias to
+// refer to the aliased type.
+func resolveAliases(pkg *types.Package, rootMap map[rootFunction]bool) {
+	prefix := pkg.Path() + "."
+	for f := range rootMap {
+		name, ok := strings.CutPrefix(f.typ, prefix)
+		if !ok {
+			continue
+		}
+		tn, ok := pkg.Scope().Lookup(name).(*types.TypeName)
+		if !ok || !tn.IsAlias() {
+			continue
+		}
+		t := types.Unalias(tn.Type())
+		if pt, isPointer := t.(*types.Pointer); isPointer {
+			t = pt.Elem()
+		}
+		delete(rootMap, f)
+		rootMap[rootFunction{typ: types.TypeString(t, nil), fun: f.fun}] = true
+	}
+}
+
+// interfaceRoots resolves the roots of rootMap that denote methods of
+// interface types declared in pkgs to the corresponding methods of their
+// implementations, and removes them from the map. Only the implementations
+// declared in the loaded packages are found.
+func (s *analyzerState) interfaceRoots(pkgs []*packages.Package, rootMap map[rootFunction]bool) []*types.Func {
+	var specs []rootFunction
+	for f := range rootMap {
+		specs = append(specs, f)
+	}
+	sort.Slice(specs, func(i, j int) bool {
+		return specs[i].typ+"."+specs[i].fun < specs[j].typ+"."+specs[j].fun
+	})
+	var roots []*types.Func
+	for _, f := range specs {
+		for _, pkg := range pkgs {
+			m := interfaceMethod(pkg.Types, f)
+			if m == nil {
+				continue
+			}
+			delete(rootMap, f)
+			impls := s.implementations(m, nil)
+			if len(impls) == 0 {
+				s.logf("no implementations of interface method root %s.%s", f.typ, f.fun)
+			}
+			roots = appendNew(roots, impls...)
+			break
+		}
+	}
+	return roots
+}
+
+// interfaceMethod returns the method of an interface type of pkg specified by
+// f, or nil if there is none.
+func interfaceMethod(pkg *types.Package, f rootFunction) *types.Func {
+	if pkg == nil {
+		return nil
+	}
+	name, ok := strings.CutPrefix(f.typ, pkg.Path()+".")
+	if !ok {
+		return nil
+	}
+	tn, ok := pkg.Scope().Lookup(name).(*types.TypeName)
+	if !ok {
+		return nil
+	}
+	iface, ok := tn.Type().Underlying().(*types.Interface)
+	if !ok {
+		return nil
+	}
+	for i := 0; i < iface.NumMethods(); i++ {
+		if m := iface.Method(i); m.Name() == f.fun {
+			return m
+		}
+	}
+	return nil
+}
+
+// appendNew appends the functions of add to funcs that are not in funcs.
+func appendNew(funcs []*types.Func, add ...*types.Func) []*types.Func {
+	for _, f := range add {
+		if !slices.Contains(funcs, f) {
+			funcs = append(funcs, f)
+		}
+	}
+	return funcs
 }
 
 func parsePatch(dir string, r io.Reader) (Patch, error) {
-	diffs := diff.NewMultiFileDiffReader(r)
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Patch{}, fmt.Errorf("failed to read diff: %v", err)
+	}
+	if mboxFrom.Match(data) {
+		data = mboxDiffs(data)
+	}
+	diffs := diff.NewMultiFileDiffReader(bytes.NewReader(data))
 	var p Patch
 	for {
 		d, err := diffs.ReadFile()
@@ -144,28 +787,68 @@ func parsePatch(dir string, r io.Reader) (Patch, error) {
 		for _, hunk := range d.Hunks {
 			startLine := int(hunk.OrigStartLine)
 			p = append(p, Hunk{
-				hunk:      hunk,
-				relFile:   origName,
-				file:      absName,
-				startLine: startLine,
-				endLine:   startLine + int(hunk.OrigLines),
+				hunk:        hunk,
+				relFile:     origName,
+				file:        absName,
+				startLine:   startLine,
+				endLine:     startLine + int(hunk.OrigLines),
+				changes:     parseChanges(hunk),
+				headRelFile: strings.TrimPrefix(d.NewName, "b/"),
 			})
 		}
 	}
-	sort.Slice(p, func(i, j int) bool {
-		h1, h2 := p[i], p[j]
-		switch strings.Compare(h1.file, h2.file) {
-		case -1:
-			return true
-		case +1:
-			return false
-		default:
-			return h1.startLine <= h2.startLine
-		}
-	})
+	sortHunks(p)
 	return p, nil
 }
 
+// mboxFrom matches the line starting each patch of a series written by
+// git format-patch.
+var mboxFrom = regexp.MustCompile(`(?m)^From [0-9a-f]{40} `)
+
+// mboxDiffs strips the email headers, commit messages and signatures from a
+// patch series in mbox format and returns the concatenated diffs.
+func mboxDiffs(mbox []byte) []byte {
+	var diffs []byte
+	inDiff := false
+	for _, line := range bytes.SplitAfter(mbox, []byte("\n")) {
+		switch {
+		case mboxFrom.Match(line):
+			inDiff = false
+		case bytes.HasPrefix(line, []byte("diff --git ")):
+			inDiff = true
+		case bytes.Equal(bytes.TrimRight(line, "\r\n"), []byte("-- ")):
+			// The signature separator ends the diff of a patch.
+			inDiff = false
+		}
+		if inDiff {
+			diffs = append(diffs, line...)
+		}
+	}
+	return diffs
+}
+
+// parseChanges returns the added and removed lines of a hunk.
+func parseChanges(hunk *diff.Hunk) []change {
+	var changes []change
+	line := int(hunk.OrigStartLine)
+	for _, l := range strings.SplitAfter(string(hunk.Body), "\n") {
+		if l == "" {
+			continue
+		}
+		text := strings.TrimSuffix(l[1:], "\n")
+		switch l[0] {
+		case ' ':
+			line++
+		case '-':
+			changes = append(changes, change{op: '-', line: line, text: text})
+			line++
+		case '+':
+			changes = append(changes, change{op: '+', line: line, text: text})
+		}
+	}
+	return changes
+}
+
 // Patch is a slice of Hunks, sorted by path then starting line.
 type Patch []Hunk
 
@@ -175,7 +858,97 @@ type Hunk struct {
 	startLine int
 	endLine   int
 	hunk      *diff.Hunk
+	changes   []change
 	stack     []stackEntry
+	// headRelFile is the path of the file at the head of the patch, which
+	// differs from relFile for renamed, added and deleted files.
+	headRelFile string
+	// atHead reports whether the lines of the hunk refer to the file at the
+	// head of the patch, after remapToHead, rather than at its base.
+	atHead bool
+	// roots are the roots reaching the hunk, in the order they are
+	// checked.
+	roots []*types.Func
+	// removes reports whether the hunk deletes lines from the body of a
+	// reachable function.
+	removes bool
+	// globals are the sorted names of the package-level variables written
+	// by the changed lines. They are only computed if checkOptions.globals
+	// is set.
+	globals []string
+	// cgoCalls are the sorted names of the C functions called through cgo
+	// by the touched function.
+	cgoCalls []string
+	// owners are the owners of the file in the CODEOWNERS file. They are
+	// only set with the -codeowners flag.
+	owners []string
+	// commentOnly reports whether the hunk only changes comments and blank
+	// lines. It is only computed if checkOptions.ignoreComments is set.
+	commentOnly bool
+	// reason is the reason given by the allow marker of an acknowledged
+	// hunk.
+	reason string
+	// lastStartLine is the start line of the last hunk merged into h, if
+	// any. Review comments must not span several hunks of the diff.
+	lastStartLine int
+	// lastHunk is the last hunk of the diff merged into h, if any.
+	lastHunk *diff.Hunk
+}
+
+// whitespaceOnly reports whether the added and removed lines of h differ only
+// in whitespace, including blank lines. The lines are compared by their Go
+// tokens, so that the whitespace inside string and rune literals counts.
+func (h *Hunk) whitespaceOnly() bool {
+	var removed, added strings.Builder
+	for _, c := range h.changes {
+		lines := &added
+		if c.op == '-' {
+			lines = &removed
+		}
+		lines.WriteString(c.text)
+		lines.WriteByte('\n')
+	}
+	return slices.Equal(scanTokens(removed.String()), scanTokens(added.String()))
+}
+
+// merge merges the finding for h2, a later hunk touching the same function,
+// into h.
+func (h *Hunk) merge(h2 *Hunk) {
+	h.lastStartLine, _ = h2.commentLines()
+	h.lastHunk = cmp.Or(h2.lastHunk, h2.hunk)
+	h.endLine = h2.endLine
+	h.changes = append(h.changes, h2.changes...)
+	h.removes = h.removes || h2.removes
+	h.roots = appendNew(h.roots, h2.roots...)
+	h.globals = append(h.globals, h2.globals...)
+	slices.Sort(h.globals)
+	h.globals = slices.Compact(h.globals)
+}
+
+// commentLines returns the lines anchoring a review comment on h, which are
+// those of the last hunk merged into it.
+func (h *Hunk) commentLines() (start, end int) {
+	if h.lastStartLine == 0 {
+		return h.startLine, h.endLine
+	}
+	return h.lastStartLine, h.endLine
+}
+
+// sameFunc reports whether h and h2 touch the same function.
+func (h *Hunk) sameFunc(h2 *Hunk) bool {
+	return h.file == h2.file && h.stack[len(h.stack)-1].fun == h2.stack[len(h2.stack)-1].fun
+}
+
+// change is an added or removed line of a hunk.
+type change struct {
+	// op is '+' for an added line and '-' for a removed line.
+	op byte
+	// line is the original line number of a removed line, or the original
+	// line preceding which a line is added. After remapToHead, it is the
+	// line number at the head of an added line, or the line at the head
+	// preceding which a line is removed.
+	line int
+	text string
 }
 
 type stackEntry struct {
@@ -203,8 +976,17 @@ func (p Patch) Mark(stack []stackEntry, file string, startLine, endLine int) {
 			break
 		}
 		// Record the stack, but only if it is shorter than any previous stack.
+		// Each hunk gets its own copy: the backing array of the previous
+		// stack may be shared by copies of the hunk.
 		if len(p[i].stack) == 0 || len(p[i].stack) > len(stack) {
-			p[i].stack = append(p[i].stack[:0], stack...)
+			p[i].stack = slices.Clone(stack)
+		}
+		p[i].roots = appendNew(p[i].roots, stack[0].fun)
+		for _, c := range h.changes {
+			if c.op == '-' && c.line >= startLine && c.line <= endLine {
+				p[i].removes = true
+				break
+			}
 		}
 	}
 }
@@ -214,40 +996,331 @@ type BodyInfo struct {
 	info *types.Info
 }
 
+// sortedFuncs returns the bodies of the loaded functions in the order of
+// their positions, so that what is collected from them, and so the callees
+// visited first, is the same in every run.
+func (s *analyzerState) sortedFuncs() []BodyInfo {
+	funcs := make([]*types.Func, 0, len(s.funcs))
+	for f := range s.funcs {
+		funcs = append(funcs, f)
+	}
+	slices.SortFunc(funcs, func(f, g *types.Func) int {
+		return cmp.Compare(f.Pos(), g.Pos())
+	})
+	infos := make([]BodyInfo, len(funcs))
+	for i, f := range funcs {
+		infos[i] = s.funcs[f]
+	}
+	return infos
+}
+
 type analyzerState struct {
 	fset  *token.FileSet
 	funcs map[*types.Func]BodyInfo
+	// types lists the concrete named types of the loaded packages, for
+	// resolving interface method calls.
+	types []*types.Named
+	// files is the set of the loaded Go files.
+	files map[string]bool
+	// cgoFiles is the set of the files generated by cgo from the loaded Go
+	// files, which are parsed in their place.
+	cgoFiles map[string]bool
+	// hooks maps hook extraction functions to the functions registered
+	// as hooks.
+	hooks map[rootFunction][]*types.Func
+	// excludedEdges are the calls excluded from the call graph.
+	excludedEdges map[edge]bool
+	// fieldFuncs maps struct fields and local variables of function type,
+	// and containers of functions, to the functions assigned to them.
+	fieldFuncs map[*types.Var][]*types.Func
+	// pinnedTypes maps unexported struct fields of interface type to the
+	// concrete types of the values assigned to them, if all of them are
+	// known.
+	pinnedTypes map[*types.Var][]types.Type
+	// linknames are the //go:linkname directives of the loaded packages.
+	linknames []linkname
+	// linked maps functions declared without a body to the functions
+	// linked to them.
+	linked map[*types.Func][]*types.Func
+	// resolvers resolve the callees of calls, in order.
+	resolvers []Resolver
+	logf      func(format string, args ...any)
 }
 
-func inspect(state *analyzerState, patch Patch, def *types.Func, stack []stackEntry) {
+// addPackage registers the types and functions declared in pkg. It returns
+// the functions that match a root of rootMap and removes them from the map.
+// Declarations without type information, as may happen in packages that failed
+// to type check, are skipped.
+func (s *analyzerState) addPackage(pkg *packages.Package, rootMap map[rootFunction]bool) []*types.Func {
+	if pkg.Types != nil {
+		scope := pkg.Types.Scope()
+		for _, name := range scope.Names() {
+			tn, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || tn.IsAlias() {
+				continue
+			}
+			if named, ok := tn.Type().(*types.Named); ok && !types.IsInterface(named) && named.TypeParams().Len() == 0 {
+				s.types = append(s.types, named)
+			}
+		}
+	}
+	if pkg.TypesInfo == nil {
+		s.logf("skipping package %s: no type information", pkg.PkgPath)
+		return nil
+	}
+	for _, name := range pkg.GoFiles {
+		s.files[name] = true
+	}
+	for _, name := range pkg.CompiledGoFiles {
+		if !slices.Contains(pkg.GoFiles, name) {
+			s.cgoFiles[name] = true
+		}
+	}
+	var rootFuncs []*types.Func
+	for _, f := range pkg.Syntax {
+		if pkg.Types != nil {
+			s.linknames = append(s.linknames, linknameDirectives(pkg.Types, f)...)
+		}
+		for _, decl := range f.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				td, ok := pkg.TypesInfo.Defs[decl.Name].(*types.Func)
+				if !ok {
+					s.logf("skipping %s: no type information for %s", s.fset.Position(decl.Pos()), decl.Name.Name)
+					continue
+				}
+				inf := BodyInfo{decl, pkg.TypesInfo}
+				s.funcs[td] = inf
+				if rf := rootFunctionOf(td); rootMap[rf] {
+					delete(rootMap, rf)
+					rootFuncs = append(rootFuncs, td)
+				}
+			}
+		}
+	}
+	return rootFuncs
+}
+
+// position returns the position of pos in the source files. Line directives
+// are only obeyed in the files generated by cgo, whose lines map to the Go
+// files they are generated from.
+func (s *analyzerState) position(pos token.Pos) token.Position {
+	p := s.fset.PositionFor(pos, false)
+	if s.cgoFiles[p.Filename] {
+		return s.fset.PositionFor(pos, true)
+	}
+	return p
+}
+
+// implementations returns the methods of every concrete type that implements
+// the interface declaring m, if m is an interface method. If the method is
+// called through a value of interface type recv, such as an interface
+// embedding the declaring interface, the implementations must implement the
+// complete method set of recv.
+func (s *analyzerState) implementations(m *types.Func, recv types.Type) []*types.Func {
+	declRecv := m.Type().(*types.Signature).Recv()
+	if declRecv == nil {
+		return nil
+	}
+	iface, ok := declRecv.Type().Underlying().(*types.Interface)
+	if !ok {
+		return nil
+	}
+	if recv != nil {
+		if i, ok := recv.Underlying().(*types.Interface); ok {
+			iface = i
+		}
+	}
+	var impls []*types.Func
+	for _, named := range s.types {
+		var t types.Type = named
+		if !types.Implements(t, iface) {
+			t = types.NewPointer(named)
+			if !types.Implements(t, iface) {
+				continue
+			}
+		}
+		obj, _, _ := types.LookupFieldOrMethod(t, false, m.Pkg(), m.Name())
+		if f, ok := obj.(*types.Func); ok {
+			impls = append(impls, f)
+		}
+	}
+	return impls
+}
+
+// inspect marks the hunks touched by def and the functions it calls, skipping
+// the visited functions. It returns ctx.Err() if ctx is done before the walk
+// completes.
+func inspect(ctx context.Context, state *analyzerState, patch Patch, def *types.Func, stack []stackEntry, visited map[*types.Func]bool) error {
 	inf, ok := state.funcs[def]
-	if !ok || inf.fun.Body == nil {
-		return
+	if !ok || inf.fun.Body == nil || visited[def] {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
 	}
-	delete(state.funcs, def)
+	visited[def] = true
 	stack = append(stack, stackEntry{fun: def, pos: inf.fun.Pos()})
-	start := state.fset.PositionFor(inf.fun.Body.Pos(), false)
-	end := state.fset.PositionFor(inf.fun.Body.End(), false)
+	start := state.position(inf.fun.Body.Pos())
+	end := state.position(inf.fun.Body.End())
 	if start.IsValid() && end.IsValid() {
 		patch.Mark(stack, start.Filename, start.Line, end.Line)
 	}
+	for _, callee := range state.callees(def, inf) {
+		if err := inspect(ctx, state, patch, callee, stack, visited); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// callees returns the functions potentially called by the body of def, as
+// resolved by the resolvers of s, in the order of their call sites. The calls
+// in function literals, such as deferred recover handlers, are included, as
+// are the iterator functions ranged over by range-over-func loops. Excluded
+// calls are omitted.
+func (s *analyzerState) callees(def *types.Func, inf BodyInfo) []*types.Func {
+	var callees []*types.Func
 	ast.Inspect(inf.fun.Body, func(n ast.Node) bool {
 		switch n := n.(type) {
 		case *ast.CallExpr:
-			var id *ast.Ident
-			switch fun := n.Fun.(type) {
-			case *ast.Ident:
-				id = fun
-			case *ast.SelectorExpr:
-				id = fun.Sel
-			}
-			switch t := inf.info.Uses[id].(type) {
-			case *types.Func:
-				inspect(state, patch, t, stack)
+			for _, r := range s.resolvers {
+				callees = append(callees, r.Resolve(n, inf.info)...)
 			}
+		case *ast.RangeStmt:
+			callees = append(callees, s.iterators(inf.info, n)...)
 		}
 		return true
 	})
+	return slices.DeleteFunc(callees, func(callee *types.Func) bool {
+		return s.excluded(def, callee)
+	})
+}
+
+// iterators returns the functions called by the range-over-func loop n, such
+// as k.All in
+//
+//	for x := range k.All {
+//
+// The iterators returned by calls, as in range k.All(), are declared by the
+// called functions, whose function literals are followed.
+func (s *analyzerState) iterators(info *types.Info, n *ast.RangeStmt) []*types.Func {
+	t := info.TypeOf(n.X)
+	if t == nil {
+		return nil
+	}
+	if _, ok := t.Underlying().(*types.Signature); !ok {
+		return nil
+	}
+	if f := funcValue(info, n.X); f != nil {
+		return []*types.Func{f}
+	}
+	return s.funcValues(info, n.X)
+}
+
+// calledFunc returns the function or method statically called by call, if
+// any. Parentheses around the called expression are ignored; those around
+// the receiver, as in (&k).Commit(), are part of the selector.
+func calledFunc(info *types.Info, call *ast.CallExpr) *types.Func {
+	fun := ast.Unparen(call.Fun)
+	// Explicit instantiations, as in NewCollection[K, V](...), call the
+	// generic function.
+	switch x := fun.(type) {
+	case *ast.IndexExpr:
+		fun = x.X
+	case *ast.IndexListExpr:
+		fun = x.X
+	}
+	var id *ast.Ident
+	switch fun := fun.(type) {
+	case *ast.Ident:
+		id = fun
+	case *ast.SelectorExpr:
+		id = fun.Sel
+	}
+	return usedFunc(info, id)
+}
+
+// usedFunc returns the function or method used by id, if any. The methods of
+// instantiated generic types, as Set in
+//
+//	NewCollection[K, V](...).Set(k, v)
+//
+// are the generic methods declaring their bodies.
+func usedFunc(info *types.Info, id *ast.Ident) *types.Func {
+	f, ok := info.Uses[id].(*types.Func)
+	if !ok {
+		return nil
+	}
+	return f.Origin()
+}
+
+// receiverType returns the type of the receiver expression of the method call,
+// if any.
+func receiverType(info *types.Info, call *ast.CallExpr) types.Type {
+	sel, ok := ast.Unparen(call.Fun).(*ast.SelectorExpr)
+	if !ok {
+		return nil
+	}
+	if selection, ok := info.Selections[sel]; ok && selection.Kind() == types.MethodVal {
+		return selection.Recv()
+	}
+	return nil
+}
+
+// funcValue returns the function or method denoted by the expression, if it
+// is a function value such as
+//
+//	pkg.Function
+//	k.Method
+//	Handler(pkg.Function)
+func funcValue(info *types.Info, e ast.Expr) *types.Func {
+	// Conversions to named function types keep the function.
+	for {
+		conv, ok := ast.Unparen(e).(*ast.CallExpr)
+		if !ok || len(conv.Args) != 1 || !info.Types[conv.Fun].IsType() {
+			break
+		}
+		e = conv.Args[0]
+	}
+	var id *ast.Ident
+	switch e := ast.Unparen(e).(type) {
+	case *ast.Ident:
+		id = e
+	case *ast.SelectorExpr:
+		id = e.Sel
+	}
+	return usedFunc(info, id)
+}
+
+// reachable returns the functions reachable from root, each mapped to a
+// shortest call path from root.
+func (s *analyzerState) reachable(ctx context.Context, root *types.Func) (map[*types.Func][]*types.Func, error) {
+	paths := map[*types.Func][]*types.Func{root: {root}}
+	queue := []*types.Func{root}
+	for len(queue) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		f := queue[0]
+		queue = queue[1:]
+		inf, ok := s.funcs[f]
+		if !ok || inf.fun.Body == nil {
+			continue
+		}
+		path := paths[f]
+		for _, callee := range s.callees(f, inf) {
+			if _, seen := paths[callee]; seen {
+				continue
+			}
+			if inf, ok := s.funcs[callee]; !ok || inf.fun.Body == nil {
+				continue
+			}
+			paths[callee] = append(path[:len(path):len(path)], callee)
+			queue = append(queue, callee)
+		}
+	}
+	return paths, nil
 }
 
 type stringSlice []string
@@ -265,3 +1338,24 @@ func (ss *stringSlice) Set(flag string) error {
 	}
 	return nil
 }
+
+type intSlice []int
+
+func (is *intSlice) String() string {
+	s := make([]string, len(*is))
+	for i, n := range *is {
+		s[i] = strconv.Itoa(n)
+	}
+	return strings.Join(s, ",")
+}
+
+func (is *intSlice) Set(flag string) error {
+	for _, s := range strings.Split(flag, ",") {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		*is = append(*is, n)
+	}
+	return nil
+}
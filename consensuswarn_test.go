@@ -2,9 +2,24 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
 	"go/token"
+	"go/types"
+	"io"
 	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
 	"testing"
+	"time"
+
+	"golang.org/x/tools/go/packages"
 )
 
 func TestInvalidRoots(t *testing.T) {
@@ -13,12 +28,103 @@ func TestInvalidRoots(t *testing.T) {
 		"github.com/orijtech/consensuswarn/testdata.T.MissingMethod",
 	}
 	for _, root := range invalids {
-		if _, err := runCheck(new(token.FileSet), "", bytes.NewReader(nil), []string{root}); err == nil {
+		if _, err := runCheck(context.Background(), new(token.FileSet), "", bytes.NewReader(nil), []string{root}, checkOptions{}); err == nil {
 			t.Errorf("root %q was unexpectedly accepted", root)
 		}
 	}
 }
 
+func TestParseRoot(t *testing.T) {
+	tests := []struct {
+		root     string
+		f        rootFunction
+		pkgPaths []string
+	}{
+		{"example.com/p.F", rootFunction{"example.com/p", "F"}, []string{"example.com/p"}},
+		{"example.com/p.T.M", rootFunction{"example.com/p.T", "M"}, []string{"example.com/p", "example.com/p.T"}},
+		{"gopkg.in/foo.v2.F", rootFunction{"gopkg.in/foo.v2", "F"}, []string{"gopkg.in/foo", "gopkg.in/foo.v2"}},
+		{"gopkg.in/foo.v2/bar.v1.T.M", rootFunction{"gopkg.in/foo.v2/bar.v1.T", "M"}, []string{"gopkg.in/foo.v2/bar.v1", "gopkg.in/foo.v2/bar.v1.T"}},
+	}
+	for _, test := range tests {
+		f, pkgPaths, err := parseRoot(test.root)
+		if err != nil {
+			t.Errorf("%s: %v", test.root, err)
+			continue
+		}
+		if f != test.f || !reflect.DeepEqual(pkgPaths, test.pkgPaths) {
+			t.Errorf("%s: parsed %v in %v, expected %v in %v", test.root, f, pkgPaths, test.f, test.pkgPaths)
+		}
+	}
+	for _, root := range []string{"example.com/p", "example.com/p.", "example.com/.F"} {
+		if _, _, err := parseRoot(root); err == nil {
+			t.Errorf("%s: malformed root accepted", root)
+		}
+	}
+}
+
+func TestDottedPackageRoots(t *testing.T) {
+	roots := []string{
+		"github.com/orijtech/consensuswarn/testdata/foo.v2.Func",
+		"github.com/orijtech/consensuswarn/testdata/foo.v2.Keeper.Commit",
+		"github.com/orijtech/consensuswarn/testdata/foo.v2/bar.v1.Store.Write",
+	}
+	prog, err := load(context.Background(), new(token.FileSet), "", roots, checkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, root := range prog.roots {
+		names = append(names, root.FullName())
+	}
+	sort.Strings(names)
+	want := []string{
+		"(*github.com/orijtech/consensuswarn/testdata/foo.v2.Keeper).Commit",
+		"(github.com/orijtech/consensuswarn/testdata/foo.v2/bar.v1.Store).Write",
+		"github.com/orijtech/consensuswarn/testdata/foo.v2.Func",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("resolved roots %v, expected %v", names, want)
+	}
+}
+
+func TestErrorTypes(t *testing.T) {
+	ctx := context.Background()
+	_, err := runCheck(ctx, new(token.FileSet), "", bytes.NewReader(nil), []string{
+		"github.com/orijtech/consensuswarn/testdata.T.MissingMethod",
+		"github.com/orijtech/consensuswarn/testdata.MissingFunc",
+	}, checkOptions{})
+	var missing *MissingRootsError
+	if !errors.As(err, &missing) {
+		t.Fatalf("expected missing roots, got %v", err)
+	}
+	want := []string{
+		"github.com/orijtech/consensuswarn/testdata.MissingFunc",
+		"github.com/orijtech/consensuswarn/testdata.T.MissingMethod",
+	}
+	if !reflect.DeepEqual(missing.Roots, want) {
+		t.Errorf("missing roots %v, expected %v", missing.Roots, want)
+	}
+
+	_, err = runCheck(ctx, new(token.FileSet), "", bytes.NewReader(nil), []string{"github.com/orijtech/consensuswarn/testdata"}, checkOptions{})
+	var malformed *MalformedRootError
+	if !errors.As(err, &malformed) || malformed.Root != "github.com/orijtech/consensuswarn/testdata" {
+		t.Errorf("expected malformed root, got %v", err)
+	}
+
+	dir := writeModule(t, map[string]string{
+		"broken/broken.go": "package broken\n\nfunc F() { undefined() }\n",
+	})
+	_, err = runCheck(ctx, new(token.FileSet), dir, bytes.NewReader(nil), []string{"example.com/m/broken.F"}, checkOptions{})
+	var loadErr *PackageLoadError
+	if !errors.As(err, &loadErr) {
+		t.Fatalf("expected package load error, got %v", err)
+	}
+	var pkgErr packages.Error
+	if !errors.As(err, &pkgErr) || !strings.Contains(pkgErr.Msg, "undefined") {
+		t.Errorf("expected the type error to be wrapped, got %v", err)
+	}
+}
+
 func TestPatch(t *testing.T) {
 	patch, err := os.ReadFile("testdata/state1.patch")
 	if err != nil {
@@ -33,11 +139,1032 @@ func TestPatch(t *testing.T) {
 		"github.com/orijtech/consensuswarn/testdata.T.RootMethod1",
 	}
 	fset := new(token.FileSet)
-	hunks, err := runCheck(fset, cwd, bytes.NewReader(patch), roots)
+	res, err := runCheck(context.Background(), fset, cwd, bytes.NewReader(patch), roots, checkOptions{})
 	if err != nil {
 		t.Fatal(err)
 	}
-	if len(hunks) != 2 {
+	if hunks := res.hunks; len(hunks) != 2 {
 		t.Errorf("expected 2 state changing hunk, got %d", len(hunks))
 	}
 }
+
+func TestReportUnreached(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch, err := os.ReadFile("testdata/state1.patch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := []string{
+		"github.com/orijtech/consensuswarn/testdata.RootFunc1",
+		"github.com/orijtech/consensuswarn/testdata.T.RootMethod1",
+	}
+	res, err := runCheck(context.Background(), new(token.FileSet), cwd, bytes.NewReader(patch), roots, checkOptions{reportUnreached: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := func(hunks []Hunk) []int {
+		var lines []int
+		for _, h := range hunks {
+			lines = append(lines, h.startLine)
+		}
+		return lines
+	}
+	if got, want := lines(res.hunks), []int{14, 44}; !reflect.DeepEqual(got, want) {
+		t.Errorf("reached hunks at lines %v, expected %v", got, want)
+	}
+	// The change to the patch file itself is not in a Go file.
+	if got, want := lines(res.unreached), []int{28, 56}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unreached hunks at lines %v, expected %v", got, want)
+	}
+}
+
+func TestDeletion(t *testing.T) {
+	hunks := checkPatch(t, "testdata/deletion.patch", "github.com/orijtech/consensuswarn/testdata/deletion.Root")
+	if len(hunks) != 1 {
+		t.Fatalf("expected 1 state changing hunk, got %d", len(hunks))
+	}
+	if !hunks[0].removes {
+		t.Error("expected hunk to be reported as removing reachable code")
+	}
+}
+
+func TestAliasRoot(t *testing.T) {
+	hunks := checkPatch(t, "testdata/alias.patch", "github.com/orijtech/consensuswarn/testdata/alias.Keeper.Set")
+	if len(hunks) != 1 {
+		t.Fatalf("expected 1 state changing hunk, got %d", len(hunks))
+	}
+}
+
+func TestMergeSameFunc(t *testing.T) {
+	hunks := checkPatch(t, "testdata/samefunc.patch", "github.com/orijtech/consensuswarn/testdata/samefunc.Root")
+	if len(hunks) != 1 {
+		t.Fatalf("expected 1 finding, got %d", len(hunks))
+	}
+	if h := hunks[0]; h.startLine != 14 || h.endLine != 29 {
+		t.Errorf("finding spans lines %d-%d, expected 14-29", h.startLine, h.endLine)
+	}
+}
+
+func TestPatchSeries(t *testing.T) {
+	hunks := checkPatch(t, "testdata/series.mbox",
+		"github.com/orijtech/consensuswarn/testdata.RootFunc1",
+		"github.com/orijtech/consensuswarn/testdata.T.RootMethod1",
+	)
+	if len(hunks) != 2 {
+		t.Fatalf("expected 2 state changing hunks, got %d", len(hunks))
+	}
+	for i, fun := range []string{"StateFunc1", "StateMethod1"} {
+		if got := hunks[i].stack[len(hunks[i].stack)-1].fun.Name(); got != fun {
+			t.Errorf("hunk %d touches %s, expected %s", i, got, fun)
+		}
+	}
+}
+
+func TestExcludeEdges(t *testing.T) {
+	const pkg = "github.com/orijtech/consensuswarn/testdata/edges"
+	exclude := func(specs ...string) checkOptions {
+		var opts checkOptions
+		for _, spec := range specs {
+			e, err := parseEdge(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts.excludeEdges = append(opts.excludeEdges, e)
+		}
+		return opts
+	}
+	touched := func(hunks []Hunk) []string {
+		var names []string
+		for _, h := range hunks {
+			var path []string
+			for _, e := range h.stack {
+				path = append(path, e.fun.Name())
+			}
+			names = append(names, strings.Join(path, "->"))
+		}
+		return names
+	}
+	hunks := checkPatchOptions(t, "testdata/edges.patch", exclude(pkg+".a->"+pkg+".deep"), pkg+".Root")
+	if got, want := touched(hunks), []string{"Root->a->log"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("call paths %v, expected %v", got, want)
+	}
+	// The other path to log remains.
+	hunks = checkPatchOptions(t, "testdata/edges.patch", exclude(pkg+".a->"+pkg+".log"), pkg+".Root")
+	if got, want := touched(hunks), []string{"Root->a->deep", "Root->b->log"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("call paths %v, expected %v", got, want)
+	}
+}
+
+func TestPublicAPI(t *testing.T) {
+	opts := checkOptions{publicAPI: []string{"github.com/orijtech/consensuswarn/testdata/publicapi"}}
+	hunks := checkPatchOptions(t, "testdata/publicapi.patch", opts)
+	var got []string
+	for _, hunk := range hunks {
+		got = append(got, hunk.stack[0].fun.FullName()+" -> "+hunk.stack[len(hunk.stack)-1].fun.Name())
+	}
+	// The exported method of the unexported type and the unexported
+	// function called by no exported function are not public.
+	want := []string{
+		"github.com/orijtech/consensuswarn/testdata/publicapi.Transfer -> move",
+		"(github.com/orijtech/consensuswarn/testdata/publicapi.Bank).Send -> debit",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findings\n%s\nexpected\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestStrict(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := []string{"github.com/orijtech/consensuswarn/testdata/strict.Root"}
+	res, err := runCheck(context.Background(), new(token.FileSet), cwd, strings.NewReader(""), roots, checkOptions{strict: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, spot := range res.blindSpots {
+		got = append(got, fmt.Sprintf("%s:%d: %s", spot.relFile, spot.pos.Line, spot.reason))
+	}
+	want := []string{
+		"testdata/strict/strict.go:12: call of an untracked function value",
+		"testdata/strict/strict.go:13: call of Write through an interface without known implementations",
+		"testdata/strict/strict.go:14: reflective call",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("blind spots\n%s\nexpected\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	// The blind spots fail the check in every format.
+	for _, f := range []string{"text", "json", "junit", "dot", "html"} {
+		setFlag(t, format, f)
+		if code := printFindings(io.Discard, new(token.FileSet), res); code != exitFindings {
+			t.Errorf("%s: exit code %d for blind spots, expected %d", f, code, exitFindings)
+		}
+	}
+	res, err = runCheck(context.Background(), new(token.FileSet), cwd, strings.NewReader(""), roots, checkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.blindSpots) != 0 {
+		t.Errorf("blind spots reported without strict mode: %v", res.blindSpots)
+	}
+	// The functional options called by New are followed at its calls.
+	res, err = runCheck(context.Background(), new(token.FileSet), cwd, strings.NewReader(""), []string{"github.com/orijtech/consensuswarn/testdata/options.Root"}, checkOptions{strict: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.blindSpots) != 0 {
+		t.Errorf("blind spots reported for functional options: %v", res.blindSpots)
+	}
+}
+
+func TestMinChangedLines(t *testing.T) {
+	const root = "github.com/orijtech/consensuswarn/testdata/hunksize.State.Root"
+	for _, test := range []struct {
+		min  int
+		want []string
+	}{
+		{1, []string{"small", "large"}},
+		{2, []string{"large"}},
+		{5, nil},
+	} {
+		hunks := checkPatchOptions(t, "testdata/hunksize.patch", checkOptions{minChangedLines: test.min}, root)
+		var touched []string
+		for _, h := range hunks {
+			touched = append(touched, h.stack[len(h.stack)-1].fun.Name())
+		}
+		if !reflect.DeepEqual(touched, test.want) {
+			t.Errorf("-min-changed-lines %d: touched functions %v, expected %v", test.min, touched, test.want)
+		}
+	}
+}
+
+func TestIgnoreComments(t *testing.T) {
+	const root = "github.com/orijtech/consensuswarn/testdata/comments.State.Root"
+	for _, test := range []struct {
+		ignore bool
+		want   []string
+	}{
+		{false, []string{"documented", "explained", "annotated", "changed"}},
+		{true, []string{"annotated", "changed"}},
+	} {
+		hunks := checkPatchOptions(t, "testdata/comments.patch", checkOptions{ignoreComments: test.ignore}, root)
+		var touched []string
+		for _, h := range hunks {
+			touched = append(touched, h.stack[len(h.stack)-1].fun.Name())
+		}
+		if !reflect.DeepEqual(touched, test.want) {
+			t.Errorf("-ignore-comments=%v: touched functions %v, expected %v", test.ignore, touched, test.want)
+		}
+	}
+}
+
+func TestAllowMarker(t *testing.T) {
+	patch, err := os.ReadFile("testdata/allow.patch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := runCheck(context.Background(), new(token.FileSet), cwd, bytes.NewReader(patch), []string{"github.com/orijtech/consensuswarn/testdata/allow.Keeper.Root"}, checkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.hunks) != 1 || res.hunks[0].stack[len(res.hunks[0].stack)-1].fun.Name() != "setState" {
+		t.Errorf("expected a single finding in setState, got %d", len(res.hunks))
+	}
+	if len(res.acknowledged) != 1 {
+		t.Fatalf("%d acknowledged hunks, expected 1", len(res.acknowledged))
+	}
+	ack := res.acknowledged[0]
+	if name := ack.stack[len(ack.stack)-1].fun.Name(); name != "setFee" {
+		t.Errorf("acknowledged hunk in %s, expected setFee", name)
+	}
+	if want := "the fee is not part of the state"; ack.reason != want {
+		t.Errorf("reason %q, expected %q", ack.reason, want)
+	}
+	out := new(bytes.Buffer)
+	printFindings(out, new(token.FileSet), res)
+	if want := "testdata/allow/allow.go:18: acknowledged change reachable from (*github.com/orijtech/consensuswarn/testdata/allow.Keeper).Root: the fee is not part of the state\n"; !strings.Contains(out.String(), want) {
+		t.Errorf("output\n%s\nlacks\n%s", out, want)
+	}
+}
+
+func TestLinkname(t *testing.T) {
+	// The call of the declaration without a body is followed into the
+	// linked function.
+	hunks := checkPatch(t, "testdata/linkname.patch", "github.com/orijtech/consensuswarn/testdata/linkname.Root")
+	if len(hunks) != 1 {
+		t.Fatalf("expected 1 state changing hunk, got %d", len(hunks))
+	}
+	var path []string
+	for _, e := range hunks[0].stack {
+		path = append(path, e.fun.FullName())
+	}
+	want := []string{
+		"github.com/orijtech/consensuswarn/testdata/linkname.Root",
+		"github.com/orijtech/consensuswarn/testdata/linkname/impl.setState",
+	}
+	if !reflect.DeepEqual(path, want) {
+		t.Errorf("call sequence %v, expected %v", path, want)
+	}
+}
+
+func TestCustomResolver(t *testing.T) {
+	// The handler dispatched by Root is only followed with the resolver of
+	// the dispatch; see TestExpectations.
+	const root = "github.com/orijtech/consensuswarn/testdata/resolver.Root"
+	if hunks := checkPatch(t, "testdata/resolver.patch", root); len(hunks) != 0 {
+		t.Fatalf("expected no state changing hunk without the resolver, got %d", len(hunks))
+	}
+}
+
+func TestGlobals(t *testing.T) {
+	hunks := checkPatchOptions(t, "testdata/globals.patch", checkOptions{globals: true}, "github.com/orijtech/consensuswarn/testdata/globals.Root")
+	if len(hunks) != 2 {
+		t.Fatalf("expected 2 state changing hunks, got %d", len(hunks))
+	}
+	if got, want := hunks[0].globals, []string{"counter", "total"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("bump writes globals %v, expected %v", got, want)
+	}
+	// The local variable shadows the global.
+	if got := hunks[1].globals; len(got) != 0 {
+		t.Errorf("local writes globals %v, expected none", got)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	// The hook called by Root is only followed with the -hook of its
+	// registration; see TestExpectations.
+	const root = "github.com/orijtech/consensuswarn/testdata/hooks.Root"
+	if hunks := checkPatch(t, "testdata/hooks.patch", root); len(hunks) != 0 {
+		t.Errorf("expected no state changing hunks without hooks, got %d", len(hunks))
+	}
+}
+
+func TestIgnoreWhitespace(t *testing.T) {
+	const root = "github.com/orijtech/consensuswarn/testdata/whitespace.Root"
+	if hunks := checkPatch(t, "testdata/whitespace.patch", root); len(hunks) != 1 {
+		t.Errorf("expected 1 state changing hunk, got %d", len(hunks))
+	}
+	if hunks := checkPatchOptions(t, "testdata/whitespace.patch", checkOptions{ignoreWhitespace: true}, root); len(hunks) != 0 {
+		t.Errorf("expected whitespace change to be ignored, got %d hunks", len(hunks))
+	}
+	// The whitespace inside literals is part of the code.
+	for _, test := range []struct {
+		removed, added string
+		want           bool
+	}{
+		{`	s := "a b"`, `	s  :=  "a b"`, true},
+		{`	s := "a b"`, `	s := "a  b"`, false},
+		{`	r := ' '`, `	r := '\t'`, false},
+	} {
+		h := Hunk{changes: []change{{op: '-', text: test.removed}, {op: '+', text: test.added}}}
+		if got := h.whitespaceOnly(); got != test.want {
+			t.Errorf("whitespaceOnly of %q -> %q = %v, expected %v", test.removed, test.added, got, test.want)
+		}
+	}
+}
+
+func TestTestFiles(t *testing.T) {
+	const patch = `diff --git a/keeper/keeper_test.go b/keeper/keeper_test.go
+--- a/keeper/keeper_test.go
++++ b/keeper/keeper_test.go
+@@ -3,3 +3,4 @@
+ func helper() {
++	println("test change")
+ }
+ 
+`
+	p, err := parsePatch("/src", strings.NewReader(patch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := types.NewPackage("example.com/keeper", "keeper")
+	sig := types.NewSignatureType(nil, nil, nil, nil, nil, false)
+	stack := []stackEntry{{fun: types.NewFunc(token.NoPos, pkg, "helper", sig)}}
+	p.Mark(stack, filepath.Join("/src", "keeper/keeper_test.go"), 3, 4)
+	if hunks, _ := p.findings(checkOptions{}); len(hunks) != 0 {
+		t.Errorf("expected test file hunk to be dropped, got %d hunks", len(hunks))
+	}
+	if hunks, _ := p.findings(checkOptions{includeTestFiles: true}); len(hunks) != 1 {
+		t.Errorf("expected test file hunk to be included, got %d hunks", len(hunks))
+	}
+}
+
+func TestMarkCopiesStack(t *testing.T) {
+	const patch = `diff --git a/keeper/keeper.go b/keeper/keeper.go
+--- a/keeper/keeper.go
++++ b/keeper/keeper.go
+@@ -3,3 +3,4 @@
+ func commit() {
++	println("commit")
+ }
+ 
+@@ -13,3 +14,4 @@
+ func apply() {
++	println("apply")
+ }
+ 
+`
+	p, err := parsePatch("/src", strings.NewReader(patch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := types.NewPackage("example.com/keeper", "keeper")
+	sig := types.NewSignatureType(nil, nil, nil, nil, nil, false)
+	entry := func(name string) stackEntry {
+		return stackEntry{fun: types.NewFunc(token.NoPos, pkg, name, sig)}
+	}
+	file := filepath.Join("/src", "keeper/keeper.go")
+	root := entry("Root")
+	// Both hunks are first reached by the same call sequence, which the
+	// caller goes on to reuse.
+	stack := []stackEntry{root, entry("deliver"), entry("commit")}
+	p.Mark(stack, file, 3, 16)
+	stack[2] = entry("other")
+	before := slices.Clone(p)
+	// A shorter call sequence from the same root reaches the first hunk.
+	p.Mark([]stackEntry{root, entry("apply")}, file, 3, 5)
+	names := func(stack []stackEntry) string {
+		var names []string
+		for _, e := range stack {
+			names = append(names, e.fun.Name())
+		}
+		return strings.Join(names, " -> ")
+	}
+	for _, tt := range []struct {
+		hunk *Hunk
+		want string
+	}{
+		{&before[0], "Root -> deliver -> commit"},
+		{&before[1], "Root -> deliver -> commit"},
+		{&p[0], "Root -> apply"},
+		{&p[1], "Root -> deliver -> commit"},
+	} {
+		if got := names(tt.hunk.stack); got != tt.want {
+			t.Errorf("hunk at line %d reached by %s, expected %s", tt.hunk.startLine, got, tt.want)
+		}
+	}
+}
+
+func TestQuotedPaths(t *testing.T) {
+	const patch = `diff --git "a/keeper/\303\251 \"q\".go" "b/keeper/\303\251 \"q\".go"
+--- "a/keeper/\303\251 \"q\".go"
++++ "b/keeper/\303\251 \"q\".go"
+@@ -3,3 +3,4 @@
+ func helper() {
++	println("change")
+ }
+ 
+diff --git a/keeper/with space.go b/keeper/with space.go
+--- a/keeper/with space.go	
++++ b/keeper/with space.go	
+@@ -3,3 +3,4 @@
+ func helper() {
++	println("change")
+ }
+ 
+`
+	p, err := parsePatch("/src", strings.NewReader(patch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join("/src", "keeper", "with space.go"),
+		filepath.Join("/src", "keeper", "\u00e9 \"q\".go"),
+	}
+	if len(p) != len(want) {
+		t.Fatalf("got %d hunks, expected %d", len(p), len(want))
+	}
+	for i, h := range p {
+		if h.file != want[i] {
+			t.Errorf("hunk %d: got file %q, expected %q", i, h.file, want[i])
+		}
+	}
+}
+
+// checkPatch runs the check on the patch file with the working directory as
+// base directory.
+func checkPatch(t *testing.T, patchFile string, roots ...string) []Hunk {
+	t.Helper()
+	return checkPatchOptions(t, patchFile, checkOptions{}, roots...)
+}
+
+// checkPatchOptions is like checkPatch but with options.
+func checkPatchOptions(t *testing.T, patchFile string, opts checkOptions, roots ...string) []Hunk {
+	t.Helper()
+	patch, err := os.ReadFile(patchFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := runCheck(context.Background(), new(token.FileSet), cwd, bytes.NewReader(patch), roots, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.hunks
+}
+
+// countdownContext is a context that is canceled after Err has been called
+// a number of times.
+type countdownContext struct {
+	context.Context
+	n int
+}
+
+func (c *countdownContext) Err() error {
+	if c.n <= 0 {
+		return context.Canceled
+	}
+	c.n--
+	return nil
+}
+
+func TestCancel(t *testing.T) {
+	patch, err := os.ReadFile("testdata/state1.patch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := []string{
+		"github.com/orijtech/consensuswarn/testdata.RootFunc1",
+		"github.com/orijtech/consensuswarn/testdata.T.RootMethod1",
+	}
+	// Cancel after the walk has started.
+	ctx := &countdownContext{Context: context.Background(), n: 3}
+	_, err = runCheck(ctx, new(token.FileSet), "", bytes.NewReader(patch), roots, checkOptions{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestSoftTimeout(t *testing.T) {
+	patch, err := os.ReadFile("testdata/state1.patch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := []string{
+		"github.com/orijtech/consensuswarn/testdata.RootFunc1",
+		"github.com/orijtech/consensuswarn/testdata.T.RootMethod1",
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, err := runCheck(context.Background(), new(token.FileSet), cwd, bytes.NewReader(patch), roots, checkOptions{softTimeout: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full.partial || len(full.hunks) != 2 {
+		t.Fatalf("expected the 2 findings of the complete walk, got %d, partial %v", len(full.hunks), full.partial)
+	}
+	// The timeout passes while the patch is parsed, before the walk.
+	res, err := runCheck(context.Background(), new(token.FileSet), cwd, bytes.NewReader(patch), roots, checkOptions{softTimeout: time.Nanosecond})
+	if err != nil {
+		t.Fatalf("expected partial results, got %v", err)
+	}
+	if !res.partial {
+		t.Error("results are not marked partial")
+	}
+	if len(res.hunks) >= len(full.hunks) {
+		t.Errorf("expected fewer findings than the %d of the complete walk, got %d", len(full.hunks), len(res.hunks))
+	}
+	for _, h := range res.hunks {
+		if !slices.ContainsFunc(full.hunks, func(f Hunk) bool { return f.fingerprint() == h.fingerprint() }) {
+			t.Errorf("partial finding %s:%d is not a finding of the complete walk", h.relFile, h.startLine)
+		}
+	}
+}
+
+func TestReachability(t *testing.T) {
+	roots := []string{
+		"github.com/orijtech/consensuswarn/testdata.RootFunc1",
+		"github.com/orijtech/consensuswarn/testdata.T.RootMethod1",
+	}
+	res, err := runCheck(context.Background(), new(token.FileSet), "", bytes.NewReader(nil), roots, checkOptions{reachability: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string][]string)
+	for root, paths := range res.reachable {
+		for f, path := range paths {
+			var names []string
+			for _, p := range path {
+				names = append(names, p.Name())
+			}
+			got[root.Name()+"->"+f.Name()] = names
+		}
+	}
+	want := map[string][]string{
+		"RootFunc1->RootFunc1":      {"RootFunc1"},
+		"RootFunc1->StateFunc1":     {"RootFunc1", "StateFunc1"},
+		"RootMethod1->RootMethod1":  {"RootMethod1"},
+		"RootMethod1->StateMethod1": {"RootMethod1", "StateMethod1"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("reachable functions\n%v\nexpected\n%v", got, want)
+	}
+}
+
+func TestMissingTypeInfo(t *testing.T) {
+	fset := new(token.FileSet)
+	f, err := parser.ParseFile(fset, "broken.go", "package broken\n\nfunc F() {}\n", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A package whose type information lacks the declaration of F.
+	pkg := &packages.Package{
+		PkgPath:   "example.com/broken",
+		Types:     types.NewPackage("example.com/broken", "broken"),
+		Syntax:    []*ast.File{f},
+		TypesInfo: &types.Info{Defs: make(map[*ast.Ident]types.Object)},
+	}
+	var logged []string
+	state := &analyzerState{
+		fset:  fset,
+		funcs: make(map[*types.Func]BodyInfo),
+		logf: func(format string, args ...any) {
+			logged = append(logged, fmt.Sprintf(format, args...))
+		},
+	}
+	rootMap := map[rootFunction]bool{{typ: "example.com/broken", fun: "F"}: true}
+	if roots := state.addPackage(pkg, rootMap); len(roots) != 0 {
+		t.Errorf("matched roots without type information: %v", roots)
+	}
+	if len(logged) != 1 {
+		t.Errorf("expected the skipped declaration to be logged, got %q", logged)
+	}
+}
+
+func TestInternalRoots(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"x/bank/internal/keeper/keeper.go": "package keeper\n\nimport \"example.com/m/x/bank/internal/store\"\n\ntype Keeper struct{}\n\nfunc (k *Keeper) Commit() {\n\tstore.Set()\n}\n",
+		"x/bank/internal/store/store.go":   "package store\n\nvar n int\n\nfunc Set() {\n\tn++\n}\n",
+	})
+	const patch = `diff --git a/x/bank/internal/store/store.go b/x/bank/internal/store/store.go
+--- a/x/bank/internal/store/store.go
++++ b/x/bank/internal/store/store.go
+@@ -5,3 +5,3 @@ var n int
+ func Set() {
+-	n++
++	n += 2
+ }
+`
+	for _, root := range []string{"example.com/m/x/bank/internal/keeper.Keeper.Commit", "keeper.Keeper.Commit"} {
+		res, err := runCheck(context.Background(), new(token.FileSet), dir, strings.NewReader(patch), []string{root}, checkOptions{})
+		if err != nil {
+			t.Fatalf("%s: %v", root, err)
+		}
+		if len(res.hunks) != 1 {
+			t.Fatalf("%s: %d hunks, expected 1", root, len(res.hunks))
+		}
+		if got := res.hunks[0].stack[len(res.hunks[0].stack)-1].fun.FullName(); got != "example.com/m/x/bank/internal/store.Set" {
+			t.Errorf("%s: touched %s, expected example.com/m/x/bank/internal/store.Set", root, got)
+		}
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"keeper/keeper.go":  "package keeper\n\ntype Keeper struct{}\n",
+		"keeper/private.go": "//go:build private\n\npackage keeper\n\nfunc (k *Keeper) Set() {}\n",
+	})
+	roots := []string{"example.com/m/keeper.Keeper.Set"}
+	_, err := load(context.Background(), new(token.FileSet), dir, roots, checkOptions{})
+	var missing *MissingRootsError
+	if !errors.As(err, &missing) {
+		t.Fatalf("expected the root to be missing without the build tag, got %v", err)
+	}
+	prog, err := load(context.Background(), new(token.FileSet), dir, roots, checkOptions{env: []string{"GOFLAGS=-tags=private"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prog.roots) != 1 {
+		t.Errorf("%d roots resolved, expected 1", len(prog.roots))
+	}
+}
+
+func TestShorthandRoots(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"keeper/keeper.go":   "package keeper\n\ntype Keeper struct{}\n\nfunc (k *Keeper) Set() {}\n",
+		"x/a/store/store.go": "package store\n\nfunc Set() {}\n",
+		"x/b/store/store.go": "package store\n\nfunc Set() {}\n",
+	})
+	res, err := runCheck(context.Background(), new(token.FileSet), dir, bytes.NewReader(nil), []string{"keeper.Keeper.Set"}, checkOptions{reachability: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.reachable) != 1 {
+		t.Fatalf("expected 1 root, got %d", len(res.reachable))
+	}
+	for root := range res.reachable {
+		if got, want := root.FullName(), "(*example.com/m/keeper.Keeper).Set"; got != want {
+			t.Errorf("resolved root %s, expected %s", got, want)
+		}
+	}
+	_, err = runCheck(context.Background(), new(token.FileSet), dir, bytes.NewReader(nil), []string{"store.Set"}, checkOptions{})
+	if err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Errorf("expected ambiguous root error, got %v", err)
+	}
+
+	// Roots naming no package of the module are import paths.
+	dir = writeModule(t, map[string]string{"keeper.go": "package keeper\n\nfunc Set() {}\n"})
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module consensus\n\ngo 1.22\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	res, err = runCheck(context.Background(), new(token.FileSet), dir, bytes.NewReader(nil), []string{"consensus.Set", "sort.Sort"}, checkOptions{reachability: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for root := range res.reachable {
+		got = append(got, root.FullName())
+	}
+	slices.Sort(got)
+	if want := []string{"consensus.Set", "sort.Sort"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("resolved roots %v, expected %v", got, want)
+	}
+}
+
+// writeModule writes the files to a temporary directory containing the module
+// example.com/m and returns the directory.
+func writeModule(t testing.TB, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	files["go.mod"] = "module example.com/m\n\ngo 1.22\n"
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestPlatformRoots(t *testing.T) {
+	// Each platform declares its own Root, and only the changes of its
+	// file are reached.
+	const root = "github.com/orijtech/consensuswarn/testdata/platform.Root"
+	for _, goos := range []string{"linux", "darwin"} {
+		opts := checkOptions{env: []string{"GOOS=" + goos}}
+		hunks := checkPatchOptions(t, "testdata/platform.patch", opts, root)
+		if len(hunks) != 1 {
+			t.Fatalf("GOOS=%s: expected 1 state changing hunk, got %d", goos, len(hunks))
+		}
+		if want := "testdata/platform/root_" + goos + ".go"; !strings.HasSuffix(hunks[0].file, want) {
+			t.Errorf("GOOS=%s: hunk of %s, expected %s", goos, hunks[0].file, want)
+		}
+	}
+	// No file declares Root on the other platforms.
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = load(context.Background(), new(token.FileSet), cwd, []string{root}, checkOptions{env: []string{"GOOS=windows"}})
+	if err == nil {
+		t.Error("expected Root not to resolve for GOOS=windows")
+	}
+}
+
+func TestMutualRecursion(t *testing.T) {
+	const pkg = "github.com/orijtech/consensuswarn/testdata/recursion"
+	roots := []string{pkg + ".State.Root", pkg + ".State.Other"}
+	patch, err := os.ReadFile("testdata/recursion.patch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// even and odd call each other, and count calls itself. Walking each
+	// root separately lets Other explore the functions visited from Root
+	// and record the shorter call sequence of odd.
+	for _, test := range []struct {
+		everyRoot bool
+		oddRoot   string
+	}{
+		{false, "Root"},
+		{true, "Other"},
+	} {
+		opts := checkOptions{everyRoot: test.everyRoot, reachability: true}
+		res, err := runCheck(context.Background(), new(token.FileSet), cwd, bytes.NewReader(patch), roots, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var touched []string
+		for _, h := range res.hunks {
+			touched = append(touched, h.stack[len(h.stack)-1].fun.Name())
+		}
+		if want := []string{"even", "odd", "count"}; !reflect.DeepEqual(touched, want) {
+			t.Fatalf("everyRoot=%v: touched functions %v, expected %v", test.everyRoot, touched, want)
+		}
+		if root := res.hunks[1].stack[0].fun.Name(); root != test.oddRoot {
+			t.Errorf("everyRoot=%v: odd reached from %s, expected %s", test.everyRoot, root, test.oddRoot)
+		}
+		if test.everyRoot {
+			for _, h := range res.hunks {
+				if len(h.roots) != 2 {
+					t.Errorf("%s reached from %d roots, expected 2", h.stack[len(h.stack)-1].fun.Name(), len(h.roots))
+				}
+			}
+		}
+		for root, funcs := range res.reachable {
+			// The roots, even, odd and count.
+			if len(funcs) != 4 {
+				t.Errorf("%d functions reachable from %s, expected 4", len(funcs), root.Name())
+			}
+		}
+	}
+}
+
+func TestTreeAtHead(t *testing.T) {
+	// The tree is checked out at the head of the patch, in which helper
+	// moves mutate 4 lines down from its base lines.
+	dir := writeModule(t, map[string]string{"keeper/keeper.go": `package keeper
+
+var state int
+
+func Root() {
+	mutate()
+}
+
+func helper() {
+	state = 2
+}
+
+func spacer() {
+	_ = 0
+}
+
+func mutate() {
+	state = 10
+}
+`})
+	const patch = `diff --git a/keeper/keeper.go b/keeper/keeper.go
+--- a/keeper/keeper.go
++++ b/keeper/keeper.go
+@@ -8,2 +8,6 @@ func Root() {
+ 
++func helper() {
++	state = 2
++}
++
+ func spacer() {
+@@ -13,3 +17,3 @@ func spacer() {
+ func mutate() {
+-	state = 1
++	state = 10
+ }
+`
+	roots := []string{"example.com/m/keeper.Root"}
+	// At the base lines, the change of mutate lands on spacer.
+	res, err := runCheck(context.Background(), new(token.FileSet), dir, strings.NewReader(patch), roots, checkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.hunks) != 0 {
+		t.Errorf("expected no finding without remapping, got %d", len(res.hunks))
+	}
+	opts := checkOptions{treeAtHead: true, globals: true}
+	res, err = runCheck(context.Background(), new(token.FileSet), dir, strings.NewReader(patch), roots, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.hunks) != 1 {
+		t.Fatalf("expected 1 finding after remapping, got %d", len(res.hunks))
+	}
+	h := res.hunks[0]
+	if touched := h.stack[len(h.stack)-1].fun.Name(); touched != "mutate" || h.startLine != 17 || h.endLine != 20 {
+		t.Errorf("finding for %s at lines %d-%d, expected mutate at lines 17-20", touched, h.startLine, h.endLine)
+	}
+	// The added line is the one type checked in the tree.
+	if want := []change{{op: '-', line: 18, text: "\tstate = 1"}, {op: '+', line: 18, text: "\tstate = 10"}}; !reflect.DeepEqual(h.changes, want) {
+		t.Errorf("changes %+v, expected %+v", h.changes, want)
+	}
+	if !reflect.DeepEqual(h.globals, []string{"state"}) {
+		t.Errorf("written globals %v, expected [state]", h.globals)
+	}
+}
+
+func TestRemapRenamedFile(t *testing.T) {
+	const patch = `diff --git a/old.go b/new.go
+similarity index 90%
+rename from old.go
+rename to new.go
+--- a/old.go
++++ b/new.go
+@@ -1,2 +1,4 @@
+ package p
++
++var a int
+ 
+@@ -10,3 +12,3 @@ func f() {
+ func g() {
+-	_ = 1
++	_ = 2
+ }
+@@ -20,3 +22,3 @@ func g() {
+ func h() {
+-	_ = 1
++	_ = 2
+ }
+`
+	p, err := parsePatch("/src", strings.NewReader(patch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.remapToHead("/src")
+	var got []int
+	for _, h := range p {
+		if h.relFile != "new.go" {
+			t.Errorf("hunk of %s, expected new.go", h.relFile)
+		}
+		got = append(got, h.startLine)
+	}
+	// Every hunk after the first is moved by the 2 added lines.
+	if want := []int{1, 12, 22}; !reflect.DeepEqual(got, want) {
+		t.Errorf("start lines %v, expected %v", got, want)
+	}
+}
+
+func TestRemapInsertions(t *testing.T) {
+	const patch = `diff --git a/added.go b/added.go
+new file mode 100644
+--- /dev/null
++++ b/added.go
+@@ -0,0 +1,2 @@
++package p
++
+diff --git a/p.go b/p.go
+--- a/p.go
++++ b/p.go
+@@ -5,0 +6,2 @@ func f() {
++	_ = 1
++	_ = 2
+@@ -9,1 +10,0 @@ func g() {
+-	_ = 3
+`
+	p, err := parsePatch("/src", strings.NewReader(patch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.remapToHead("/src")
+	type lines struct {
+		file       string
+		start, end int
+		changes    []int
+	}
+	var got []lines
+	for _, h := range p {
+		l := lines{file: h.relFile, start: h.startLine, end: h.endLine}
+		for _, c := range h.changes {
+			l.changes = append(l.changes, c.line)
+		}
+		got = append(got, l)
+	}
+	// Added lines are at their own lines, and the removed line at the
+	// line it precedes.
+	want := []lines{
+		{"added.go", 1, 3, []int{1, 2}},
+		{"p.go", 6, 8, []int{6, 7}},
+		{"p.go", 11, 11, []int{11}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("hunks %+v, expected %+v", got, want)
+	}
+}
+
+// syntheticModule writes a module whose Root calls breadth functions, each of
+// which calls the breadth functions of the next of depth levels, and returns
+// its directory with a patch changing every function of the last level.
+func syntheticModule(tb testing.TB, breadth, depth int) (string, string) {
+	tb.Helper()
+	var src, patch strings.Builder
+	src.WriteString("package graph\n\nvar state int\n")
+	line := 3
+	calls := func(level int) {
+		for i := 0; i < breadth; i++ {
+			fmt.Fprintf(&src, "\tf%d_%d()\n", level, i)
+			line++
+		}
+	}
+	src.WriteString("\nfunc Root() {\n")
+	line += 2
+	calls(0)
+	src.WriteString("}\n")
+	line++
+	fmt.Fprintf(&patch, "diff --git a/graph/graph.go b/graph/graph.go\n--- a/graph/graph.go\n+++ b/graph/graph.go\n")
+	for level := 0; level < depth; level++ {
+		for i := 0; i < breadth; i++ {
+			fmt.Fprintf(&src, "\nfunc f%d_%d() {\n\tstate++\n", level, i)
+			line += 3
+			if level == depth-1 {
+				fmt.Fprintf(&patch, "@@ -%d,1 +%d,1 @@\n-\tstate++\n+\tstate += 2\n", line, line)
+			} else {
+				calls(level + 1)
+			}
+			src.WriteString("}\n")
+			line++
+		}
+	}
+	return writeModule(tb, map[string]string{"graph/graph.go": src.String()}), patch.String()
+}
+
+func BenchmarkRunCheck(b *testing.B) {
+	for _, size := range []struct{ breadth, depth int }{
+		{2, 2},
+		{8, 8},
+		{32, 8},
+		{8, 64},
+	} {
+		b.Run(fmt.Sprintf("breadth=%d/depth=%d", size.breadth, size.depth), func(b *testing.B) {
+			dir, patch := syntheticModule(b, size.breadth, size.depth)
+			roots := []string{"example.com/m/graph.Root"}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				res, err := runCheck(context.Background(), new(token.FileSet), dir, strings.NewReader(patch), roots, checkOptions{})
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(res.hunks) != size.breadth {
+					b.Fatalf("%d findings, expected %d", len(res.hunks), size.breadth)
+				}
+			}
+		})
+	}
+}
+
+// rangeOverFunc reports whether the type checker accepts the range-over-func
+// loops of Go 1.23, the version required by testdata/rangefunc.
+func rangeOverFunc() bool {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", "package p\n\nfunc f(seq func(func() bool)) {\n\tfor range seq {\n\t}\n}\n", 0)
+	if err != nil {
+		return false
+	}
+	conf := &types.Config{GoVersion: "go1.23"}
+	_, err = conf.Check("p", fset, []*ast.File{f}, nil)
+	return err == nil
+}
+
+func TestRangeOverFunc(t *testing.T) {
+	if !rangeOverFunc() {
+		t.Skip("range-over-func requires Go 1.23")
+	}
+	// Root ranges over the method value k.Items and the iterator returned
+	// by k.Pending.
+	checkExpectations(t, "testdata/rangefunc", checkOptions{})
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// writeDot writes the call sequences of the findings of res to w as a
+// Graphviz DOT graph, with the touched functions highlighted.
+func writeDot(w io.Writer, res *checkResult) error {
+	var b strings.Builder
+	b.WriteString("digraph consensuswarn {\n")
+	b.WriteString("\tnode [shape=box];\n")
+	nodes := make(map[string]bool)
+	touched := make(map[string]bool)
+	edges := make(map[[2]string]bool)
+	for _, hunk := range res.hunks {
+		for i, e := range hunk.stack {
+			name := e.fun.FullName()
+			if !nodes[name] {
+				nodes[name] = true
+				fmt.Fprintf(&b, "\t%q;\n", name)
+			}
+			if i == 0 {
+				continue
+			}
+			edge := [2]string{hunk.stack[i-1].fun.FullName(), name}
+			if !edges[edge] {
+				edges[edge] = true
+				fmt.Fprintf(&b, "\t%q -> %q;\n", edge[0], edge[1])
+			}
+		}
+		name := hunk.stack[len(hunk.stack)-1].fun.FullName()
+		if !touched[name] {
+			touched[name] = true
+			fmt.Fprintf(&b, "\t%q [style=filled, fillcolor=salmon];\n", name)
+		}
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDot(t *testing.T) {
+	hunks := checkPatch(t, "testdata/options.patch", "github.com/orijtech/consensuswarn/testdata/options.Root")
+	out := new(bytes.Buffer)
+	if err := writeDot(out, &checkResult{hunks: hunks}); err != nil {
+		t.Fatal(err)
+	}
+	dot := out.String()
+	if !strings.HasPrefix(dot, "digraph consensuswarn {\n") || !strings.HasSuffix(dot, "}\n") {
+		t.Fatalf("malformed graph:\n%s", dot)
+	}
+	const pkg = "github.com/orijtech/consensuswarn/testdata/options"
+	want := []string{
+		`"` + pkg + `.Root";`,
+		`"` + pkg + `.Root" -> "` + pkg + `.WithDefaults";`,
+		`"` + pkg + `.WithDefaults" -> "(*` + pkg + `.Keeper).setLimit";`,
+		`"(*` + pkg + `.Keeper).setLimit" [style=filled, fillcolor=salmon];`,
+		`"(*` + pkg + `.Keeper).setStore" [style=filled, fillcolor=salmon];`,
+	}
+	for _, line := range want {
+		if !strings.Contains(dot, "\t"+line+"\n") {
+			t.Errorf("graph lacks %s:\n%s", line, dot)
+		}
+	}
+	if strings.Contains(dot, "setUnused") {
+		t.Errorf("graph contains the unreachable setUnused:\n%s", dot)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"go/types"
+	"strings"
+)
+
+// edge is a call from caller to callee.
+type edge struct {
+	caller rootFunction
+	callee rootFunction
+}
+
+// parseEdge parses an edge specified as caller->callee, where both are
+// functions or methods in the form of roots.
+func parseEdge(spec string) (edge, error) {
+	caller, callee, ok := strings.Cut(spec, "->")
+	if !ok {
+		return edge{}, fmt.Errorf("malformed edge: %s", spec)
+	}
+	var e edge
+	var err error
+	if e.caller, _, err = parseRoot(caller); err != nil {
+		return edge{}, err
+	}
+	if e.callee, _, err = parseRoot(callee); err != nil {
+		return edge{}, err
+	}
+	return e, nil
+}
+
+// excluded reports whether the call from caller to callee is excluded from
+// the call graph.
+func (s *analyzerState) excluded(caller, callee *types.Func) bool {
+	if len(s.excludedEdges) == 0 {
+		return false
+	}
+	return s.excludedEdges[edge{rootFunctionOf(caller), rootFunctionOf(callee)}]
+}
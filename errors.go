@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// MissingRootsError is returned when roots are not declared in the loaded
+// packages.
+type MissingRootsError struct {
+	// Roots are the sorted missing roots.
+	Roots []string
+}
+
+func (e *MissingRootsError) Error() string {
+	return "missing roots: " + strings.Join(e.Roots, ",")
+}
+
+// PackageLoadError is returned when the packages of the roots or their
+// dependencies fail to load.
+type PackageLoadError struct {
+	Errors []packages.Error
+}
+
+func (e *PackageLoadError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return "failed to load packages: " + strings.Join(msgs, "; ")
+}
+
+func (e *PackageLoadError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+// MalformedRootError is returned for a root that is not of the form of a
+// function or method.
+type MalformedRootError struct {
+	Root string
+}
+
+func (e *MalformedRootError) Error() string {
+	return "malformed function or method: " + e.Root
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestExpectations checks the functions reachable from the roots of the
+// annotated fixtures. In each package, the functions annotated with
+//
+//	func Root() { // want root
+//
+// are the roots, and exactly the functions annotated with
+//
+//	func commit() { // want reachable
+//
+// and the roots are expected to be reachable from them. If the fixture has a
+// patch, testdata/pkg.patch, exactly the functions annotated with
+//
+//	func commit() { // want touched
+//
+// are expected to be touched by its findings; they are reachable too. An
+// annotation may list several of root, reachable and touched. Adding a case
+// of a resolver is a matter of writing an annotated fixture.
+func TestExpectations(t *testing.T) {
+	const testdata = "github.com/orijtech/consensuswarn/testdata/"
+	h, err := parseHook(testdata + "hooks.SetHook=" + testdata + "hooks.GetHook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deep, err := parseEdge(testdata + "edges.a->" + testdata + "edges.deep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		pkg  string
+		opts checkOptions
+		// roots are the roots in addition to the annotated ones, such as
+		// those named through aliases and interfaces.
+		roots []string
+	}{
+		{pkg: "addr"},
+		{pkg: "alias", roots: []string{testdata + "alias.Keeper.Set"}},
+		{pkg: "complit"},
+		{pkg: "edges", opts: checkOptions{excludeEdges: []edge{deep}}},
+		{pkg: "embedded"},
+		{pkg: "embediface"},
+		{pkg: "fieldfunc"},
+		{pkg: "forward"},
+		{pkg: "funcslice"},
+		{pkg: "functype"},
+		{pkg: "generic"},
+		{pkg: "genericctor"},
+		{pkg: "handlermap"},
+		{pkg: "hooks", opts: checkOptions{hooks: []hook{h}}},
+		{pkg: "hookslice"},
+		{pkg: "ifaceroot", roots: []string{testdata + "ifaceroot.StateWriter.Write"}},
+		{pkg: "indexed"},
+		{pkg: "linkname"},
+		{pkg: "methodvalue"},
+		{pkg: "oncefunc"},
+		{pkg: "options"},
+		{pkg: "pinned"},
+		{pkg: "recovery"},
+		{pkg: "recursion"},
+		{pkg: "samefunc"},
+		{pkg: "selchain"},
+		{pkg: "unpinned"},
+	} {
+		t.Run(test.pkg, func(t *testing.T) {
+			checkExpectations(t, filepath.Join("testdata", test.pkg), test.opts, test.roots...)
+		})
+	}
+}
+
+// dispatchResolver follows dispatch("name") to the function name of the same
+// package, as a resolver of a codebase would.
+var dispatchResolver = ResolverFunc(func(call *ast.CallExpr, info *types.Info) []*types.Func {
+	f := calledFunc(info, call)
+	if f == nil || f.Name() != "dispatch" || len(call.Args) != 1 {
+		return nil
+	}
+	tv, ok := info.Types[call.Args[0]]
+	if !ok || tv.Value == nil {
+		return nil
+	}
+	handler, _ := f.Pkg().Scope().Lookup(constant.StringVal(tv.Value)).(*types.Func)
+	if handler == nil {
+		return nil
+	}
+	return []*types.Func{handler}
+})
+
+func TestRegisterResolver(t *testing.T) {
+	setFlag(t, &registeredResolvers, nil)
+	RegisterResolver(dispatchResolver)
+	setupRun(t)
+	opts, err := checkOptionsFromFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkExpectations(t, "testdata/resolver", opts)
+}
+
+// expectation is an annotated function of a fixture.
+type expectation struct {
+	// pos is the file:line of the function name, relative to the
+	// directory of the fixture.
+	pos  string
+	name string
+}
+
+func (e expectation) String() string {
+	return e.pos + ": " + e.name
+}
+
+// checkExpectations checks that the functions declared in the packages in
+// dir and its subdirectories that are reachable with opts from the annotated
+// roots and roots are exactly the annotated functions, and that the functions
+// touched by the findings of the patch of dir, if any, are exactly the
+// functions annotated as touched.
+func checkExpectations(t *testing.T, dir string, opts checkOptions, roots ...string) {
+	t.Helper()
+	annotated, want, wantTouched := readExpectations(t, dir)
+	roots = append(annotated, roots...)
+	if len(roots) == 0 {
+		t.Fatalf("no roots in %s", dir)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch, err := os.ReadFile(dir + ".patch")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		t.Fatal(err)
+	}
+	fset := new(token.FileSet)
+	opts.reachability = true
+	res, err := runCheck(context.Background(), fset, cwd, bytes.NewReader(patch), roots, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	abs := filepath.Join(cwd, dir)
+	// expectationOf returns the expectation of f, if it is declared in
+	// dir.
+	expectationOf := func(f *types.Func) (expectation, bool) {
+		pos := fset.Position(f.Pos())
+		rel, err := filepath.Rel(abs, pos.Filename)
+		if err != nil || !filepath.IsLocal(rel) {
+			return expectation{}, false
+		}
+		return expectation{pos: fmt.Sprintf("%s:%d", filepath.ToSlash(rel), pos.Line), name: f.Name()}, true
+	}
+	var got []expectation
+	for _, paths := range res.reachable {
+		for f := range paths {
+			if e, ok := expectationOf(f); ok && !slices.Contains(got, e) {
+				got = append(got, e)
+			}
+		}
+	}
+	compareExpectations(t, "reachable", got, want)
+	if patch == nil {
+		if len(wantTouched) > 0 {
+			t.Errorf("touched functions annotated without %s.patch", dir)
+		}
+		return
+	}
+	var touched []expectation
+	for _, h := range res.hunks {
+		if e, ok := expectationOf(h.stack[len(h.stack)-1].fun); ok && !slices.Contains(touched, e) {
+			touched = append(touched, e)
+		}
+	}
+	compareExpectations(t, "touched", touched, wantTouched)
+}
+
+// compareExpectations reports the functions of got that are not in want as
+// what but not annotated, and the functions of want that are not in got.
+func compareExpectations(t *testing.T, what string, got, want []expectation) {
+	t.Helper()
+	for _, e := range got {
+		if !slices.Contains(want, e) {
+			t.Errorf("%s is %s but not annotated", e, what)
+		}
+	}
+	for _, e := range want {
+		if !slices.Contains(got, e) {
+			t.Errorf("%s is annotated but not %s", e, what)
+		}
+	}
+}
+
+// readExpectations returns the full names of the annotated roots of the
+// packages in dir and its subdirectories, the annotated functions, including
+// the roots, and the functions annotated as touched.
+func readExpectations(t *testing.T, dir string) (roots []string, want, touched []expectation) {
+	t.Helper()
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && strings.HasSuffix(path, ".go") {
+			files = append(files, path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	for _, name := range files {
+		f, err := parser.ParseFile(fset, name, nil, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Annotations are comments at the end of the line of the name
+		// of a function.
+		annotations := make(map[int]string)
+		for _, group := range f.Comments {
+			for _, c := range group.List {
+				if annotation, ok := strings.CutPrefix(c.Text, "// want "); ok {
+					annotations[fset.Position(c.Pos()).Line] = strings.TrimSpace(annotation)
+				}
+			}
+		}
+		for _, decl := range f.Decls {
+			decl, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			pos := fset.Position(decl.Name.Pos())
+			annotation, ok := annotations[pos.Line]
+			if !ok {
+				continue
+			}
+			rel, err := filepath.Rel(dir, pos.Filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			e := expectation{pos: fmt.Sprintf("%s:%d", filepath.ToSlash(rel), pos.Line), name: decl.Name.Name}
+			for _, word := range strings.Fields(annotation) {
+				switch word {
+				case "root":
+					roots = append(roots, "github.com/orijtech/consensuswarn/"+filepath.ToSlash(filepath.Dir(name))+"."+funcDeclName(decl))
+				case "reachable":
+				case "touched":
+					touched = append(touched, e)
+				default:
+					t.Fatalf("%s: unknown annotation %q", pos, annotation)
+				}
+			}
+			want = append(want, e)
+		}
+	}
+	return roots, want, touched
+}
+
+// funcDeclName returns the name of decl as in a root, such as Type.Method for
+// a method.
+func funcDeclName(decl *ast.FuncDecl) string {
+	if decl.Recv == nil || len(decl.Recv.List) == 0 {
+		return decl.Name.Name
+	}
+	typ := decl.Recv.List[0].Type
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	switch x := typ.(type) {
+	case *ast.IndexExpr:
+		typ = x.X
+	case *ast.IndexListExpr:
+		typ = x.X
+	}
+	return typ.(*ast.Ident).Name + "." + decl.Name.Name
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"slices"
+)
+
+// collectFieldFuncs records the functions assigned to struct fields and local
+// variables of function type, and stored in slices, arrays and maps of
+// functions, such as
+//
+//	k.commit = defaultCommit
+//	Handler{OnCommit: k.commit}
+//	commit := k.Commit
+//	steps = append(steps, k.Commit)
+//
+// A call through a field, variable or element is assumed to call every
+// function ever assigned to it. The value variable of a range over a
+// container of functions holds every function of the container.
+func (s *analyzerState) collectFieldFuncs() {
+	s.fieldFuncs = make(map[*types.Var][]*types.Func)
+	// ranged maps the value variables of range statements to the
+	// containers ranged over.
+	ranged := make(map[*types.Var]*types.Var)
+	for _, inf := range s.sortedFuncs() {
+		if inf.fun.Body == nil {
+			continue
+		}
+		ast.Inspect(inf.fun.Body, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.AssignStmt:
+				if len(n.Lhs) != len(n.Rhs) {
+					break
+				}
+				for i, lhs := range n.Lhs {
+					if field := selectedField(inf.info, lhs); field != nil {
+						s.addFieldFunc(inf.info, field, n.Rhs[i])
+					} else if v := localFuncVar(inf.info, lhs); v != nil {
+						s.addFieldFunc(inf.info, v, n.Rhs[i])
+					} else if c := indexedContainer(inf.info, lhs); c != nil {
+						s.addFieldFunc(inf.info, c, n.Rhs[i])
+					} else if c := funcContainer(inf.info, lhs); c != nil {
+						s.addElementFuncs(inf.info, c, n.Rhs[i])
+					}
+				}
+			case *ast.ValueSpec:
+				if len(n.Names) != len(n.Values) {
+					break
+				}
+				for i, name := range n.Names {
+					if v := localFuncVar(inf.info, name); v != nil {
+						s.addFieldFunc(inf.info, v, n.Values[i])
+					} else if c := funcContainer(inf.info, name); c != nil {
+						s.addElementFuncs(inf.info, c, n.Values[i])
+					}
+				}
+			case *ast.RangeStmt:
+				if n.Value == nil {
+					break
+				}
+				if c := funcContainer(inf.info, n.X); c != nil {
+					if v := localFuncVar(inf.info, n.Value); v != nil {
+						ranged[v] = c
+					}
+				}
+			case *ast.CompositeLit:
+				t := inf.info.TypeOf(n)
+				if t == nil {
+					break
+				}
+				st, ok := t.Underlying().(*types.Struct)
+				if !ok {
+					break
+				}
+				for i, elt := range n.Elts {
+					field, value := structField(st, i, elt)
+					if field != nil {
+						s.addFieldFunc(inf.info, field, value)
+					}
+				}
+			}
+			return true
+		})
+	}
+	for v, c := range ranged {
+		s.fieldFuncs[v] = append(s.fieldFuncs[v], s.fieldFuncs[c]...)
+	}
+}
+
+// collectPinnedTypes records the concrete types of the values assigned to
+// unexported struct fields of interface type, including embedded interfaces,
+// such as *store in
+//
+//	k.stateWriter = &store{}
+//	K{stateWriter: &store{}}
+//
+// A field is pinned to its concrete types if no value of interface type is
+// ever assigned to it and its address is never taken. Exported fields are
+// never pinned, as they may be assigned by packages that are not loaded.
+func (s *analyzerState) collectPinnedTypes() {
+	s.pinnedTypes = make(map[*types.Var][]types.Type)
+	// dynamic is the set of the fields assigned values of interface type.
+	dynamic := make(map[*types.Var]bool)
+	add := func(info *types.Info, field *types.Var, value ast.Expr) {
+		if field.Exported() || !types.IsInterface(field.Type()) || info.Types[value].IsNil() {
+			return
+		}
+		t := info.TypeOf(value)
+		if t == nil || types.IsInterface(t) {
+			dynamic[field] = true
+			return
+		}
+		if !slices.ContainsFunc(s.pinnedTypes[field], func(u types.Type) bool { return types.Identical(t, u) }) {
+			s.pinnedTypes[field] = append(s.pinnedTypes[field], t)
+		}
+	}
+	for _, inf := range s.sortedFuncs() {
+		if inf.fun.Body == nil {
+			continue
+		}
+		ast.Inspect(inf.fun.Body, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.AssignStmt:
+				if len(n.Lhs) != len(n.Rhs) {
+					break
+				}
+				for i, lhs := range n.Lhs {
+					sel, ok := ast.Unparen(lhs).(*ast.SelectorExpr)
+					if !ok {
+						continue
+					}
+					if selection, ok := inf.info.Selections[sel]; ok && selection.Kind() == types.FieldVal {
+						add(inf.info, selection.Obj().(*types.Var).Origin(), n.Rhs[i])
+					}
+				}
+			case *ast.CompositeLit:
+				t := inf.info.TypeOf(n)
+				if t == nil {
+					break
+				}
+				st, ok := t.Underlying().(*types.Struct)
+				if !ok {
+					break
+				}
+				for i, elt := range n.Elts {
+					if field, value := literalField(st, i, elt); field != nil {
+						add(inf.info, field, value)
+					}
+				}
+			case *ast.UnaryExpr:
+				// Values may be stored through the address of the
+				// field.
+				if sel, ok := ast.Unparen(n.X).(*ast.SelectorExpr); ok && n.Op == token.AND {
+					if selection, ok := inf.info.Selections[sel]; ok && selection.Kind() == types.FieldVal {
+						dynamic[selection.Obj().(*types.Var).Origin()] = true
+					}
+				}
+			}
+			return true
+		})
+	}
+	for field := range dynamic {
+		delete(s.pinnedTypes, field)
+	}
+}
+
+// interfaceField returns the struct field of interface type through which
+// the method call is dispatched, such as the embedded StateWriter of k in
+//
+//	type K struct{ StateWriter }
+//
+//	k.Write()
+//
+// or the w field of k.w.Write(), if any.
+func interfaceField(info *types.Info, call *ast.CallExpr) *types.Var {
+	sel, ok := ast.Unparen(call.Fun).(*ast.SelectorExpr)
+	if !ok {
+		return nil
+	}
+	selection, ok := info.Selections[sel]
+	if !ok || selection.Kind() != types.MethodVal {
+		return nil
+	}
+	var field *types.Var
+	if index := selection.Index(); len(index) > 1 {
+		// The method is promoted through embedded fields.
+		t := selection.Recv()
+		for _, i := range index[:len(index)-1] {
+			if ptr, ok := t.Underlying().(*types.Pointer); ok {
+				t = ptr.Elem()
+			}
+			st, ok := t.Underlying().(*types.Struct)
+			if !ok {
+				return nil
+			}
+			field = st.Field(i)
+			t = field.Type()
+		}
+	} else if x, ok := ast.Unparen(sel.X).(*ast.SelectorExpr); ok {
+		if selection, ok := info.Selections[x]; ok && selection.Kind() == types.FieldVal {
+			field = selection.Obj().(*types.Var)
+		}
+	}
+	if field == nil || !types.IsInterface(field.Type()) {
+		return nil
+	}
+	return field.Origin()
+}
+
+// addElementFuncs records the functions, if any, stored in the container c by
+// value, which is a composite literal or a call of append.
+func (s *analyzerState) addElementFuncs(info *types.Info, c *types.Var, value ast.Expr) {
+	switch value := ast.Unparen(value).(type) {
+	case *ast.CompositeLit:
+		for _, elt := range value.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				elt = kv.Value
+			}
+			s.addFieldFunc(info, c, elt)
+		}
+	case *ast.CallExpr:
+		id, ok := ast.Unparen(value.Fun).(*ast.Ident)
+		if !ok {
+			break
+		}
+		if b, ok := info.Uses[id].(*types.Builtin); !ok || b.Name() != "append" || len(value.Args) == 0 {
+			break
+		}
+		for _, arg := range value.Args[1:] {
+			s.addFieldFunc(info, c, arg)
+		}
+	}
+}
+
+// addFieldFunc records the function value, if any, assigned to field, which
+// may also be a local variable.
+func (s *analyzerState) addFieldFunc(info *types.Info, field *types.Var, value ast.Expr) {
+	if f := funcValue(info, value); f != nil {
+		s.fieldFuncs[field] = append(s.fieldFuncs[field], f)
+	}
+}
+
+// structField returns the field of function type initialized by the i'th
+// element of a composite literal of type st, along with its value.
+func structField(st *types.Struct, i int, elt ast.Expr) (*types.Var, ast.Expr) {
+	field, value := literalField(st, i, elt)
+	if field == nil {
+		return nil, nil
+	}
+	if _, ok := field.Type().Underlying().(*types.Signature); !ok {
+		return nil, nil
+	}
+	return field, value
+}
+
+// literalField returns the field initialized by the i'th element of a
+// composite literal of type st, along with its value.
+func literalField(st *types.Struct, i int, elt ast.Expr) (*types.Var, ast.Expr) {
+	var field *types.Var
+	value := elt
+	if kv, ok := elt.(*ast.KeyValueExpr); ok {
+		key, ok := kv.Key.(*ast.Ident)
+		if !ok {
+			return nil, nil
+		}
+		for j := 0; j < st.NumFields(); j++ {
+			if f := st.Field(j); f.Name() == key.Name {
+				field = f
+			}
+		}
+		value = kv.Value
+	} else if i < st.NumFields() {
+		field = st.Field(i)
+	}
+	if field == nil {
+		return nil, nil
+	}
+	return field.Origin(), value
+}
+
+// selectedField returns the struct field of function type selected by e, if
+// any.
+func selectedField(info *types.Info, e ast.Expr) *types.Var {
+	sel, ok := ast.Unparen(e).(*ast.SelectorExpr)
+	if !ok {
+		return nil
+	}
+	selection, ok := info.Selections[sel]
+	if !ok || selection.Kind() != types.FieldVal {
+		return nil
+	}
+	field := selection.Obj().(*types.Var)
+	if _, ok := field.Type().Underlying().(*types.Signature); !ok {
+		return nil
+	}
+	return field.Origin()
+}
+
+// localFuncVar returns the local variable of function type denoted by e, if
+// any.
+func localFuncVar(info *types.Info, e ast.Expr) *types.Var {
+	id, ok := ast.Unparen(e).(*ast.Ident)
+	if !ok {
+		return nil
+	}
+	v, ok := info.ObjectOf(id).(*types.Var)
+	if !ok || v.IsField() || v.Pkg() == nil || v.Parent() == v.Pkg().Scope() {
+		return nil
+	}
+	if _, ok := v.Type().Underlying().(*types.Signature); !ok {
+		return nil
+	}
+	return v
+}
+
+// funcContainer returns the variable or struct field denoted by e if it is a
+// slice, array or map of functions.
+func funcContainer(info *types.Info, e ast.Expr) *types.Var {
+	var v *types.Var
+	switch e := ast.Unparen(e).(type) {
+	case *ast.Ident:
+		v, _ = info.ObjectOf(e).(*types.Var)
+	case *ast.SelectorExpr:
+		if selection, ok := info.Selections[e]; ok && selection.Kind() == types.FieldVal {
+			v = selection.Obj().(*types.Var).Origin()
+		}
+	}
+	if v == nil {
+		return nil
+	}
+	var elem types.Type
+	switch t := v.Type().Underlying().(type) {
+	case *types.Slice:
+		elem = t.Elem()
+	case *types.Array:
+		elem = t.Elem()
+	case *types.Map:
+		elem = t.Elem()
+	default:
+		return nil
+	}
+	if _, ok := elem.Underlying().(*types.Signature); !ok {
+		return nil
+	}
+	return v
+}
+
+// indexedContainer returns the container of functions indexed by e, such as
+// steps in steps[i], if any.
+func indexedContainer(info *types.Info, e ast.Expr) *types.Var {
+	index, ok := ast.Unparen(e).(*ast.IndexExpr)
+	if !ok {
+		return nil
+	}
+	return funcContainer(info, index.X)
+}
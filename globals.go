@@ -0,0 +1,117 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"sort"
+)
+
+// globalWrites returns the sorted names of the package-level variables written
+// by the changed lines of h, which touches the function inf. Writes on the
+// lines in the loaded files, which are the removed lines unless h is remapped
+// to the head of the patch, are identified by the type information. The other
+// lines are not type checked, so their written identifiers are looked up in
+// the package scope unless the function declares a local of the same name.
+func (s *analyzerState) globalWrites(h *Hunk, inf BodyInfo) []string {
+	removed := make(map[int]bool)
+	var added []string
+	for _, c := range h.changes {
+		if h.inTree(c) {
+			removed[c.line] = true
+		} else {
+			added = append(added, c.text)
+		}
+	}
+	names := make(map[string]bool)
+	locals := make(map[string]bool)
+	ast.Inspect(inf.fun, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			if _, ok := inf.info.Defs[id].(*types.Var); ok {
+				locals[id.Name] = true
+			}
+		}
+		for _, e := range writtenExprs(n) {
+			id := writtenIdent(inf.info, e)
+			if id == nil || !removed[s.fset.Position(id.Pos()).Line] {
+				continue
+			}
+			if v, ok := inf.info.Uses[id].(*types.Var); ok && isGlobal(v) {
+				names[v.Name()] = true
+			}
+		}
+		return true
+	})
+	pkg := h.stack[len(h.stack)-1].fun.Pkg()
+	for _, text := range added {
+		f, err := parser.ParseFile(token.NewFileSet(), "", "package p; func _() {\n"+text+"\n}", 0)
+		if err != nil {
+			continue
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			for _, e := range writtenExprs(n) {
+				id := writtenIdent(nil, e)
+				if id == nil || locals[id.Name] {
+					continue
+				}
+				if v, ok := pkg.Scope().Lookup(id.Name).(*types.Var); ok {
+					names[v.Name()] = true
+				}
+			}
+			return true
+		})
+	}
+	var sorted []string
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// writtenExprs returns the expressions assigned to by the statement n, if any.
+func writtenExprs(n ast.Node) []ast.Expr {
+	switch n := n.(type) {
+	case *ast.AssignStmt:
+		if n.Tok != token.DEFINE {
+			return n.Lhs
+		}
+	case *ast.IncDecStmt:
+		return []ast.Expr{n.X}
+	}
+	return nil
+}
+
+// writtenIdent returns the variable written through the assigned expression
+// e, such as v in
+//
+//	v.field[i] = x
+//
+// or Var in pkg.Var. If info is nil, selectors are assumed to select fields.
+func writtenIdent(info *types.Info, e ast.Expr) *ast.Ident {
+	for {
+		switch x := e.(type) {
+		case *ast.Ident:
+			return x
+		case *ast.ParenExpr:
+			e = x.X
+		case *ast.IndexExpr:
+			e = x.X
+		case *ast.SelectorExpr:
+			if id, ok := x.X.(*ast.Ident); ok && info != nil {
+				if _, ok := info.Uses[id].(*types.PkgName); ok {
+					return x.Sel
+				}
+			}
+			e = x.X
+		default:
+			return nil
+		}
+	}
+}
+
+// isGlobal reports whether v is a package-level variable.
+func isGlobal(v *types.Var) bool {
+	return v.Pkg() != nil && v.Parent() == v.Pkg().Scope()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// runHistory checks the pull requests of -pr without commenting, as if the
+// roots had been enforced when they were opened, and writes a summary of the
+// findings to w. It returns exitError if any check failed and exitOK
+// otherwise, whether or not there are findings.
+func runHistory(ctx context.Context, gh *github.Client, c *checker, w io.Writer) int {
+	owner, repo, _ := strings.Cut(*repository, "/")
+	code := exitOK
+	flagged := 0
+	byRoot := make(map[string]int)
+	for _, n := range prNumbers {
+		*prnum = n
+		hunks, err := prFindings(ctx, gh, c, owner, repo)
+		switch {
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "consensuswarn: PR %d: %v\n", n, err)
+			fmt.Fprintf(w, "PR %d: failed\n", n)
+			code = exitError
+		case len(hunks) == 0:
+			fmt.Fprintf(w, "PR %d: no findings\n", n)
+		default:
+			flagged++
+			fmt.Fprintf(w, "PR %d: %d findings\n", n, len(hunks))
+			for _, hunk := range hunks {
+				var roots []string
+				for _, root := range hunk.roots {
+					byRoot[root.FullName()]++
+					roots = append(roots, root.FullName())
+				}
+				fmt.Fprintf(w, "\t%s:%d: reachable from %s\n", hunk.relFile, hunk.startLine, strings.Join(roots, ", "))
+			}
+		}
+	}
+	fmt.Fprintf(w, "\n%d of %d PRs would have been flagged\n", flagged, len(prNumbers))
+	roots := make([]string, 0, len(byRoot))
+	for root := range byRoot {
+		roots = append(roots, root)
+	}
+	sort.Slice(roots, func(i, j int) bool {
+		if byRoot[roots[i]] != byRoot[roots[j]] {
+			return byRoot[roots[i]] > byRoot[roots[j]]
+		}
+		return roots[i] < roots[j]
+	})
+	for _, root := range roots {
+		fmt.Fprintf(w, "%d findings reachable from %s\n", byRoot[root], root)
+	}
+	return code
+}
+
+// prFindings returns the findings of c for the pull request numbered *prnum.
+func prFindings(ctx context.Context, gh *github.Client, c *checker, owner, repo string) ([]Hunk, error) {
+	_, patch, err := getDiff(ctx, gh, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.findings(ctx, patch)
+	if err != nil {
+		return nil, err
+	}
+	return res.hunks, nil
+}
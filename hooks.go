@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+)
+
+// hook describes a pair of functions for storing and retrieving a callback,
+// for example in a context.Context:
+//
+//	ctx = SetHook(ctx, mutate)
+//	...
+//	GetHook(ctx)()
+//
+// Every call to the extract function is assumed to call each function passed
+// to the register function.
+type hook struct {
+	register rootFunction
+	extract  rootFunction
+}
+
+// parseHook parses a hook specified as register=extract, where both are
+// functions or methods in the form of roots.
+func parseHook(spec string) (hook, error) {
+	register, extract, ok := strings.Cut(spec, "=")
+	if !ok {
+		return hook{}, fmt.Errorf("malformed hook: %s", spec)
+	}
+	var h hook
+	var err error
+	if h.register, _, err = parseRoot(register); err != nil {
+		return hook{}, err
+	}
+	if h.extract, _, err = parseRoot(extract); err != nil {
+		return hook{}, err
+	}
+	return h, nil
+}
+
+// collectHooks records the functions passed to the register function of any
+// of hooks.
+func (s *analyzerState) collectHooks(hooks []hook) {
+	extracts := make(map[rootFunction]rootFunction)
+	for _, h := range hooks {
+		extracts[h.register] = h.extract
+	}
+	s.hooks = make(map[rootFunction][]*types.Func)
+	for _, inf := range s.sortedFuncs() {
+		if inf.fun.Body == nil {
+			continue
+		}
+		ast.Inspect(inf.fun.Body, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			f := calledFunc(inf.info, call)
+			if f == nil {
+				return true
+			}
+			extract, ok := extracts[rootFunctionOf(f)]
+			if !ok {
+				return true
+			}
+			for _, arg := range call.Args {
+				if h := funcValue(inf.info, arg); h != nil {
+					s.hooks[extract] = append(s.hooks[extract], h)
+				}
+			}
+			return true
+		})
+	}
+}
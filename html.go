@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"go/token"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// htmlReport is the data of the HTML report of the findings.
+type htmlReport struct {
+	Lang     string
+	Text     commentText
+	Findings []htmlFinding
+}
+
+type htmlFinding struct {
+	jsonFinding
+	// URL links to the changed lines, if the repository is known.
+	URL   string
+	Depth int
+	// FramesText summarizes the number of frames of the call sequence.
+	FramesText string
+	// Frames are the frames of the call sequence from the touched function
+	// to the root.
+	Frames []htmlFrame
+}
+
+type htmlFrame struct {
+	jsonFrame
+	URL string
+}
+
+// sourceCommit is the commit of the tree of -dir as known from the pull
+// request being checked, for linking to the source of the findings.
+var sourceCommit string
+
+// repoRoot returns the root of the git repository containing dir, the
+// nearest directory with a .git entry, or dir itself if there is none.
+func repoRoot(dir string) string {
+	for d := dir; ; {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			return d
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return dir
+		}
+		d = parent
+	}
+}
+
+// sourceURL returns the link to lines start to end of file in the repository
+// rooted at root on GitHub, or the empty string if the repository is unknown
+// or file is outside root. The lines are linked at the -source-commit, or
+// else the commit of -dir known from the pull request, or else the default
+// branch.
+func sourceURL(root, file string, start, end int) string {
+	if *repository == "" {
+		return ""
+	}
+	rel, err := filepath.Rel(root, file)
+	if err != nil || !filepath.IsLocal(rel) {
+		return ""
+	}
+	commit := *linkCommit
+	if commit == "" {
+		commit = sourceCommit
+	}
+	if commit == "" {
+		commit = "HEAD"
+	}
+	url := fmt.Sprintf("https://github.com/%s/blob/%s/%s#L%d", *repository, commit, filepath.ToSlash(rel), start)
+	if end > start {
+		url += fmt.Sprintf("-L%d", end)
+	}
+	return url
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+<meta charset="utf-8">
+<title>{{.Text.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #d0d7de; padding: 0.4em 0.8em; text-align: left; vertical-align: top; }
+th { background: #f6f8fa; }
+ol { margin: 0.4em 0; padding-left: 1.5em; }
+</style>
+</head>
+<body>
+<h1>{{.Text.Title}}</h1>
+<table>
+<thead>
+<tr>{{range .Text.Columns}}<th>{{.}}</th>{{end}}</tr>
+</thead>
+<tbody>
+{{- range .Findings}}
+<tr>
+<td>{{if .URL}}<a href="{{.URL}}">{{.File}}</a>{{else}}{{.File}}{{end}}</td>
+<td>{{.StartLine}}</td>
+<td><code>{{.Root}}</code></td>
+<td>{{.Depth}}</td>
+<td><details><summary>{{.FramesText}}</summary><ol>
+{{- range .Frames}}
+<li>{{if .URL}}<a href="{{.URL}}"><code>{{.Function}}</code></a>{{else}}<code>{{.Function}}</code>{{end}} ({{.File}}:{{.Line}})</li>
+{{- end}}
+</ol></details></td>
+</tr>
+{{- end}}
+</tbody>
+</table>
+</body>
+</html>
+`))
+
+// writeHTML writes the findings of res to w as a standalone HTML page, with
+// a table of the findings linking to their source and their collapsible call
+// sequences. Paths are relative to dir where possible, and links relative to
+// the root of the repository containing dir.
+func writeHTML(w io.Writer, fset *token.FileSet, dir string, res *checkResult) error {
+	report := htmlReport{Lang: *lang, Text: text()}
+	root := repoRoot(dir)
+	for i := range res.hunks {
+		hunk := &res.hunks[i]
+		f := htmlFinding{jsonFinding: newJSONFinding(fset, dir, hunk)}
+		f.URL = sourceURL(root, hunk.file, f.StartLine, f.EndLine)
+		f.Depth = len(f.CallPath) - 1
+		f.FramesText = fmt.Sprintf(report.Text.Framesf, len(f.CallPath))
+		for i := len(f.CallPath) - 1; i >= 0; i-- {
+			frame := f.CallPath[i]
+			file := fset.Position(hunk.stack[i].pos).Filename
+			f.Frames = append(f.Frames, htmlFrame{jsonFrame: frame, URL: sourceURL(root, file, frame.Line, frame.Line)})
+		}
+		report.Findings = append(report.Findings, f)
+	}
+	return htmlTemplate.Execute(w, report)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHTML(t *testing.T) {
+	setFlag(t, repository, "orijtech/consensuswarn")
+	setFlag(t, linkCommit, "0123abc")
+	f, err := os.Open("testdata/state1.patch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := new(token.FileSet)
+	res, err := runCheck(context.Background(), fset, cwd, f, []string{"github.com/orijtech/consensuswarn/testdata.RootFunc1"}, checkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	if err := writeHTML(out, fset, cwd, res); err != nil {
+		t.Fatal(err)
+	}
+	page := out.String()
+	if n := strings.Count(page, "<tr>"); n != 2 {
+		t.Errorf("%d rows, expected a header and 1 finding:\n%s", n, page)
+	}
+	for _, want := range []string{
+		`<!DOCTYPE html>`,
+		`<a href="https://github.com/orijtech/consensuswarn/blob/0123abc/testdata/state.go#L`,
+		`<td><code>github.com/orijtech/consensuswarn/testdata.RootFunc1</code></td>`,
+		`<details><summary>2 frames</summary>`,
+		`<a href="https://github.com/orijtech/consensuswarn/blob/0123abc/testdata/state.go#L3"><code>github.com/orijtech/consensuswarn/testdata.RootFunc1</code></a> (testdata/state.go:3)`,
+		`<a href="https://github.com/orijtech/consensuswarn/blob/0123abc/testdata/state.go#L16"><code>github.com/orijtech/consensuswarn/testdata.StateFunc1</code></a> (testdata/state.go:16)`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page lacks %s:\n%s", want, page)
+		}
+	}
+}
+
+func TestSourceURL(t *testing.T) {
+	setFlag(t, repository, "orijtech/consensuswarn")
+	setFlag(t, linkCommit, "0123abc")
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(root, "chain", "x")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if got := repoRoot(dir); got != root {
+		t.Fatalf("repository root of %s is %s, expected %s", dir, got, root)
+	}
+	if got, want := sourceURL(root, filepath.Join(dir, "keeper.go"), 12, 12), "https://github.com/orijtech/consensuswarn/blob/0123abc/chain/x/keeper.go#L12"; got != want {
+		t.Errorf("link of a file under -dir is %s, expected %s", got, want)
+	}
+	// Files of dependencies in the module cache are not in the repository.
+	if got := sourceURL(root, filepath.Join(t.TempDir(), "pkg", "mod", "dep.go"), 12, 12); got != "" {
+		t.Errorf("file outside the repository linked to %s", got)
+	}
+}
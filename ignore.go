@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFileName is the name of the optional file in the base directory that
+// lists paths to exclude from the findings. The format follows .gitignore:
+//
+//   - Blank lines and lines starting with '#' are ignored.
+//   - A leading '!' negates the pattern; the last matching pattern decides.
+//   - A trailing '/' matches only directories.
+//   - A pattern containing a '/' elsewhere is relative to the base directory;
+//     other patterns match a file or directory name at any depth.
+//   - '*', '?' and character classes match within a path element, and a '**'
+//     element matches any number of path elements.
+//
+// A pattern that matches a directory excludes every file below it, and as in
+// .gitignore, a negated pattern cannot re-include a file whose parent
+// directory is excluded.
+const ignoreFileName = ".consensuswarnignore"
+
+type ignoreRule struct {
+	elems    []string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// ignoreList is the parsed content of an ignore file.
+type ignoreList []ignoreRule
+
+// readIgnoreFile reads the ignore file from dir. A missing file results in an
+// empty list.
+func readIgnoreFile(dir string) (ignoreList, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ignoreFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseIgnore(data), nil
+}
+
+func parseIgnore(data []byte) ignoreList {
+	var l ignoreList
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		negate := strings.HasPrefix(line, "!")
+		if r, ok := parsePattern(strings.TrimPrefix(line, "!")); ok {
+			r.negate = negate
+			l = append(l, r)
+		}
+	}
+	return l
+}
+
+// parsePattern parses a path pattern in the format of .gitignore without the
+// negation. It reports false for an empty pattern.
+func parsePattern(pattern string) (ignoreRule, bool) {
+	var r ignoreRule
+	if strings.HasSuffix(pattern, "/") {
+		r.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if strings.Contains(pattern, "/") {
+		r.anchored = true
+		pattern = strings.TrimPrefix(pattern, "/")
+	}
+	if pattern == "" {
+		return ignoreRule{}, false
+	}
+	r.elems = strings.Split(pattern, "/")
+	return r, true
+}
+
+// match reports whether the slash-separated path of a file, relative to the
+// base directory, is excluded. Its parent directories are checked first, from
+// the base directory down, as a file of an excluded directory is excluded.
+func (l ignoreList) match(relPath string) bool {
+	elems := strings.Split(path.Clean(relPath), "/")
+	for n := 1; n <= len(elems); n++ {
+		if l.excluded(elems[:n], n < len(elems)) {
+			return true
+		}
+	}
+	return false
+}
+
+// excluded reports whether the last pattern matching the path elems, which
+// is a directory if dir is set, excludes it.
+func (l ignoreList) excluded(elems []string, dir bool) bool {
+	ignored := false
+	for _, r := range l {
+		if r.match(elems, dir) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// matchPath reports whether r matches the path elems or one of its parent
+// directories.
+func (r ignoreRule) matchPath(elems []string) bool {
+	for n := len(elems); n > 0; n-- {
+		if r.match(elems[:n], n < len(elems)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r ignoreRule) match(elems []string, dir bool) bool {
+	if r.dirOnly && !dir {
+		return false
+	}
+	if r.anchored {
+		return matchElems(r.elems, elems)
+	}
+	return matchElems(r.elems, elems[len(elems)-1:])
+}
+
+// matchElems matches path elements against pattern elements, where a "**"
+// pattern element matches zero or more path elements.
+func matchElems(pattern, elems []string) bool {
+	if len(pattern) == 0 {
+		return len(elems) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(elems); i++ {
+			if matchElems(pattern[1:], elems[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(elems) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], elems[0]); !ok {
+		return false
+	}
+	return matchElems(pattern[1:], elems[1:])
+}
+
+// filter returns the hunks whose files are not excluded.
+func (l ignoreList) filter(hunks []Hunk) []Hunk {
+	if len(l) == 0 {
+		return hunks
+	}
+	var filtered []Hunk
+	for _, h := range hunks {
+		if !l.match(filepath.ToSlash(h.relFile)) {
+			filtered = append(filtered, h)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreMatch(t *testing.T) {
+	l := parseIgnore([]byte(`
+# Comment
+*_mock.go
+/docs/
+x/**/simulation
+!x/bank/simulation/keep.go
+state/
+!state/keep.go
+x/**/genesis/*
+!x/bank/genesis/keep.go
+`))
+	tests := []struct {
+		path    string
+		ignored bool
+	}{
+		{"keeper/keeper_mock.go", true},
+		{"keeper/keeper.go", false},
+		{"docs/state.go", true},
+		{"x/docs/state.go", false},
+		{"x/simulation/sim.go", true},
+		{"x/bank/simulation/sim.go", true},
+		// The files of excluded directories cannot be re-included.
+		{"x/bank/simulation/keep.go", true},
+		{"state/keep.go", true},
+		{"x/bank/genesis/genesis.go", true},
+		{"x/bank/genesis/keep.go", false},
+	}
+	for _, test := range tests {
+		if got := l.match(test.path); got != test.ignored {
+			t.Errorf("match(%q) = %v, expected %v", test.path, got, test.ignored)
+		}
+	}
+}
+
+func TestIgnoreFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ignoreFileName), []byte("testdata/embediface/\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	l, err := readIgnoreFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hunks := checkPatch(t, "testdata/embediface.patch", "github.com/orijtech/consensuswarn/testdata/embediface.Root")
+	if len(hunks) != 1 {
+		t.Fatalf("expected 1 state changing hunk, got %d", len(hunks))
+	}
+	if filtered := l.filter(hunks); len(filtered) != 0 {
+		t.Errorf("expected ignored directory to be excluded, got %d hunks", len(filtered))
+	}
+	hunks = checkPatch(t, "testdata/state1.patch", "github.com/orijtech/consensuswarn/testdata.RootFunc1")
+	if filtered := l.filter(hunks); len(filtered) != len(hunks) {
+		t.Errorf("expected other hunks to be kept, got %d of %d", len(filtered), len(hunks))
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"go/token"
+	"io"
+	"path/filepath"
+	"slices"
+)
+
+// jsonSchemaVersion is the version of the JSON report. It is incremented
+// when a field is removed or changes meaning; new fields may be added
+// without a new version, so consumers should ignore unknown fields.
+const jsonSchemaVersion = 1
+
+// jsonReport is the JSON report of the findings.
+type jsonReport struct {
+	SchemaVersion int           `json:"schema_version"`
+	Findings      []jsonFinding `json:"findings"`
+	// Acknowledged are the findings carrying an allow marker.
+	Acknowledged []jsonFinding `json:"acknowledged"`
+	// Hunks are the hunks of the Go files of the loaded packages, whether
+	// or not they are reachable. They are only reported with
+	// -json-all-hunks.
+	Hunks []jsonHunk `json:"hunks,omitempty"`
+	// Partial reports that the -soft-timeout stopped the check, so some
+	// findings may be missing.
+	Partial bool `json:"partial,omitempty"`
+}
+
+// jsonHunk is a changed hunk of a Go file, with the call sequence reaching it
+// if it is reachable.
+type jsonHunk struct {
+	File      string      `json:"file"`
+	StartLine int         `json:"start_line"`
+	EndLine   int         `json:"end_line"`
+	Reachable bool        `json:"reachable"`
+	Root      string      `json:"root,omitempty"`
+	CallPath  []jsonFrame `json:"call_path,omitempty"`
+}
+
+type jsonFinding struct {
+	// Root is the root of the call path.
+	Root string `json:"root"`
+	// Roots are the roots reaching the touched function, in the order
+	// they are checked.
+	Roots       []string `json:"roots"`
+	File        string   `json:"file"`
+	StartLine   int      `json:"start_line"`
+	EndLine     int      `json:"end_line"`
+	Fingerprint string   `json:"fingerprint"`
+	// CallPath is the call sequence from the root to the touched function.
+	CallPath []jsonFrame `json:"call_path"`
+	Removes  bool        `json:"removes"`
+	Globals  []string    `json:"globals,omitempty"`
+	CgoCalls []string    `json:"cgo_calls,omitempty"`
+	Owners   []string    `json:"owners,omitempty"`
+	Reason   string      `json:"reason,omitempty"`
+}
+
+type jsonFrame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+// writeJSON writes the findings of res to w as a JSON report. Paths are
+// relative to dir where possible.
+func writeJSON(w io.Writer, fset *token.FileSet, dir string, res *checkResult) error {
+	report := jsonReport{
+		SchemaVersion: jsonSchemaVersion,
+		Findings:      []jsonFinding{},
+		Acknowledged:  []jsonFinding{},
+		Partial:       res.partial,
+	}
+	for i := range res.hunks {
+		report.Findings = append(report.Findings, newJSONFinding(fset, dir, &res.hunks[i]))
+	}
+	for i := range res.acknowledged {
+		report.Acknowledged = append(report.Acknowledged, newJSONFinding(fset, dir, &res.acknowledged[i]))
+	}
+	if *jsonAllHunks {
+		all := slices.Concat(res.hunks, res.acknowledged, res.unreached)
+		sortHunks(all)
+		report.Hunks = []jsonHunk{}
+		for i := range all {
+			hunk := &all[i]
+			h := jsonHunk{File: hunk.relFile, StartLine: hunk.startLine, EndLine: hunk.endLine}
+			if len(hunk.stack) > 0 {
+				f := newJSONFinding(fset, dir, hunk)
+				h.Reachable, h.Root, h.CallPath = true, f.Root, f.CallPath
+			}
+			report.Hunks = append(report.Hunks, h)
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(report)
+}
+
+func newJSONFinding(fset *token.FileSet, dir string, hunk *Hunk) jsonFinding {
+	f := jsonFinding{
+		Root:        hunk.stack[0].fun.FullName(),
+		File:        hunk.relFile,
+		StartLine:   hunk.startLine,
+		EndLine:     hunk.endLine,
+		Fingerprint: hunk.fingerprint(),
+		Removes:     hunk.removes,
+		Globals:     hunk.globals,
+		CgoCalls:    hunk.cgoCalls,
+		Owners:      hunk.owners,
+		Reason:      hunk.reason,
+	}
+	for _, root := range hunk.roots {
+		f.Roots = append(f.Roots, root.FullName())
+	}
+	for _, e := range hunk.stack {
+		pos := fset.Position(e.pos)
+		f.CallPath = append(f.CallPath, jsonFrame{Function: e.fun.FullName(), File: relFile(dir, pos.Filename), Line: pos.Line})
+	}
+	return f
+}
+
+// relFile returns file as a slash-separated path relative to dir, or file
+// itself if it is outside dir.
+func relFile(dir, file string) string {
+	if rel, err := filepath.Rel(dir, file); err == nil && filepath.IsLocal(rel) {
+		return filepath.ToSlash(rel)
+	}
+	return file
+}
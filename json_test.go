@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"go/token"
+	"os"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	f, err := os.Open("testdata/state1.patch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := new(token.FileSet)
+	res, err := runCheck(context.Background(), fset, cwd, f, []string{"github.com/orijtech/consensuswarn/testdata.RootFunc1"}, checkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	if err := writeJSON(out, fset, cwd, res); err != nil {
+		t.Fatal(err)
+	}
+	var report map[string]any
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("invalid report: %v\n%s", err, out)
+	}
+	if v, ok := report["schema_version"].(float64); !ok || v != jsonSchemaVersion {
+		t.Errorf("schema version %v, expected %d", report["schema_version"], jsonSchemaVersion)
+	}
+	if _, ok := report["acknowledged"].([]any); !ok {
+		t.Errorf("report lacks the list of acknowledged findings:\n%s", out)
+	}
+	findings, ok := report["findings"].([]any)
+	if !ok || len(findings) != 1 {
+		t.Fatalf("expected 1 finding, got\n%s", out)
+	}
+	finding := findings[0].(map[string]any)
+	for _, field := range []string{"root", "roots", "file", "start_line", "end_line", "fingerprint", "call_path", "removes"} {
+		if _, ok := finding[field]; !ok {
+			t.Errorf("finding lacks %q:\n%s", field, out)
+		}
+	}
+	want := []jsonFrame{
+		{Function: "github.com/orijtech/consensuswarn/testdata.RootFunc1", File: "testdata/state.go", Line: 3},
+		{Function: "github.com/orijtech/consensuswarn/testdata.StateFunc1", File: "testdata/state.go", Line: 16},
+	}
+	var typed jsonReport
+	if err := json.Unmarshal(out.Bytes(), &typed); err != nil {
+		t.Fatal(err)
+	}
+	path := typed.Findings[0].CallPath
+	if len(path) != len(want) || path[0] != want[0] || path[1] != want[1] {
+		t.Errorf("call path %v, expected %v", path, want)
+	}
+	if typed.Findings[0].File != "testdata/state.go" || typed.Findings[0].Root != want[0].Function {
+		t.Errorf("finding in %s from %s, expected testdata/state.go from %s", typed.Findings[0].File, typed.Findings[0].Root, want[0].Function)
+	}
+}
+
+func TestJSONAllHunks(t *testing.T) {
+	setFlag(t, jsonAllHunks, true)
+	f, err := os.Open("testdata/state1.patch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := new(token.FileSet)
+	// Only the hunk of StateFunc1 is reachable from RootFunc1.
+	res, err := runCheck(context.Background(), fset, cwd, f, []string{"github.com/orijtech/consensuswarn/testdata.RootFunc1"}, checkOptions{reportUnreached: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	if err := writeJSON(out, fset, cwd, res); err != nil {
+		t.Fatal(err)
+	}
+	var report jsonReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("invalid report: %v\n%s", err, out)
+	}
+	if len(report.Findings) != 1 || len(report.Hunks) != 4 {
+		t.Fatalf("expected 1 finding among the 4 hunks, got\n%s", out)
+	}
+	reached, unreached := report.Hunks[0], report.Hunks[2]
+	if !reached.Reachable || reached.Root != "github.com/orijtech/consensuswarn/testdata.RootFunc1" || len(reached.CallPath) != 2 {
+		t.Errorf("first hunk %+v, expected reachable from RootFunc1 in 2 calls", reached)
+	}
+	if reached.StartLine != report.Findings[0].StartLine {
+		t.Errorf("reachable hunk at line %d, expected the finding at line %d", reached.StartLine, report.Findings[0].StartLine)
+	}
+	if unreached.Reachable || unreached.Root != "" || unreached.CallPath != nil || unreached.File != "testdata/state.go" {
+		t.Errorf("hunk of RootMethod1 %+v, expected an unreachable hunk of testdata/state.go", unreached)
+	}
+	for _, h := range report.Hunks[1:] {
+		if h.Reachable {
+			t.Errorf("hunk at line %d is reachable, expected only the first", h.StartLine)
+		}
+	}
+	// Unreachable hunks report the flag but no call sequence.
+	if !bytes.Contains(out.Bytes(), []byte(`"reachable": false`)) || bytes.Count(out.Bytes(), []byte(`"call_path"`)) != 2 {
+		t.Errorf("unexpected JSON of the hunks:\n%s", out)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"go/token"
+	"io"
+	"slices"
+	"strings"
+)
+
+// junitSuite is a JUnit test report in which each root is a test case that
+// fails if a change touches a function reachable from it.
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnit writes the findings of res to w as a JUnit report. A finding is
+// attributed to every root reaching it, which are all recorded with
+// checkOptions.everyRoot.
+func writeJUnit(w io.Writer, fset *token.FileSet, res *checkResult) error {
+	suite := junitSuite{Name: "consensuswarn", Tests: len(res.roots)}
+	for _, root := range res.roots {
+		c := junitCase{Name: root.FullName()}
+		if root.Pkg() != nil {
+			c.Classname = root.Pkg().Path()
+		}
+		var text strings.Builder
+		n := 0
+		for i := range res.hunks {
+			hunk := &res.hunks[i]
+			if !slices.Contains(hunk.roots, root) {
+				continue
+			}
+			n++
+			fmt.Fprintf(&text, "%s:%d: %s", hunk.relFile, hunk.startLine, commentBody(fset, hunk, *maxFrames))
+		}
+		if n > 0 {
+			suite.Failures++
+			c.Failure = &junitFailure{
+				Message: fmt.Sprintf("%d changes reachable from %s", n, root.Name()),
+				Text:    text.String(),
+			}
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	if err := enc.Encode(suite); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
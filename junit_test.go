@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"go/token"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestJUnit(t *testing.T) {
+	f, err := os.Open("testdata/state1.patch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := []string{
+		"github.com/orijtech/consensuswarn/testdata.RootFunc1",
+		"github.com/orijtech/consensuswarn/testdata/embediface.Root",
+	}
+	fset := new(token.FileSet)
+	res, err := runCheck(context.Background(), fset, cwd, f, roots, checkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	if err := writeJUnit(out, fset, res); err != nil {
+		t.Fatal(err)
+	}
+	var suite junitSuite
+	if err := xml.Unmarshal(out.Bytes(), &suite); err != nil {
+		t.Fatalf("invalid report: %v\n%s", err, out)
+	}
+	if suite.XMLName.Local != "testsuite" || suite.Tests != 2 || suite.Failures != 1 || len(suite.Cases) != 2 {
+		t.Fatalf("expected a suite of 2 tests with 1 failure, got\n%s", out)
+	}
+	failed := make(map[string]*junitFailure)
+	for _, c := range suite.Cases {
+		failed[c.Name] = c.Failure
+	}
+	fail := failed["github.com/orijtech/consensuswarn/testdata.RootFunc1"]
+	if fail == nil {
+		t.Fatalf("RootFunc1 passed, expected failure:\n%s", out)
+	}
+	if fail.Message != "1 changes reachable from RootFunc1" || !strings.Contains(fail.Text, "testdata/state.go:14: ") {
+		t.Errorf("unexpected failure %+v", fail)
+	}
+	if fail := failed["github.com/orijtech/consensuswarn/testdata/embediface.Root"]; fail != nil {
+		t.Errorf("embediface.Root failed: %+v", fail)
+	}
+
+	// A change reachable from several roots fails each of them.
+	dir := writeModule(t, map[string]string{"keeper/keeper.go": `package keeper
+
+var state int
+
+func DeliverTx() { set() }
+
+func Commit() { set() }
+
+func set() {
+	state = 1
+}
+`})
+	const patch = `diff --git a/keeper/keeper.go b/keeper/keeper.go
+--- a/keeper/keeper.go
++++ b/keeper/keeper.go
+@@ -10,1 +10,1 @@
+-	state = 1
++	state = 2
+`
+	roots = []string{"example.com/m/keeper.DeliverTx", "example.com/m/keeper.Commit"}
+	res, err = runCheck(context.Background(), fset, dir, strings.NewReader(patch), roots, checkOptions{everyRoot: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := writeJUnit(out, fset, res); err != nil {
+		t.Fatal(err)
+	}
+	suite = junitSuite{}
+	if err := xml.Unmarshal(out.Bytes(), &suite); err != nil {
+		t.Fatalf("invalid report: %v\n%s", err, out)
+	}
+	if suite.Tests != 2 || suite.Failures != 2 {
+		t.Errorf("expected both roots to fail, got\n%s", out)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// syncLabel adds label to the PR if found is set and removes it otherwise.
+// Nothing is requested if the labels of pr already agree, so that repeated
+// runs are idempotent.
+func syncLabel(ctx context.Context, gh *github.Client, owner, repo string, pr *github.PullRequest, label string, found bool) error {
+	labeled := false
+	for _, l := range pr.Labels {
+		// GitHub compares label names regardless of case.
+		if strings.EqualFold(l.GetName(), label) {
+			labeled = true
+		}
+	}
+	switch {
+	case found && !labeled:
+		_, _, err := gh.Issues.AddLabelsToIssue(ctx, owner, repo, *prnum, []string{label})
+		return err
+	case !found && labeled:
+		resp, err := gh.Issues.RemoveLabelForIssue(ctx, owner, repo, *prnum, label)
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			// Removed since the PR was fetched.
+			return nil
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// latestChanges maps the files changed by a commit, by their paths at the
+// commit, to the first and last lines of its hunks in them.
+type latestChanges map[string][][2]int
+
+// getLatestChanges returns the changes introduced by the head commit of the
+// PR relative to its first parent, as reported by the compare API.
+func getLatestChanges(ctx context.Context, gh *github.Client, owner, repo, head string) (latestChanges, error) {
+	commit, _, err := gh.Repositories.GetCommit(ctx, owner, repo, head)
+	if err != nil {
+		return nil, err
+	}
+	if len(commit.Parents) == 0 {
+		return nil, fmt.Errorf("head commit %s has no parent", head)
+	}
+	patch, err := getCompareDiff(ctx, gh, owner, repo, commit.Parents[0].GetSHA(), head)
+	if err != nil {
+		return nil, err
+	}
+	return parseLatestChanges(patch.Bytes())
+}
+
+// getCompareDiff returns the diff of head from its merge base with base, as
+// reported by the compare API.
+func getCompareDiff(ctx context.Context, gh *github.Client, owner, repo, base, head string) (*bytes.Buffer, error) {
+	return downloadDiff(ctx, gh, apiEndpoint(gh, "repos/%s/%s/compare/%s...%s", owner, repo, base, head))
+}
+
+// parseLatestChanges returns the changes of the diff of a commit.
+func parseLatestChanges(data []byte) (latestChanges, error) {
+	diffs, err := diff.ParseMultiFileDiff(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read diff: %v", err)
+	}
+	changes := make(latestChanges)
+	for _, d := range diffs {
+		name := strings.TrimPrefix(d.NewName, "b/")
+		if d.NewName == "/dev/null" {
+			name = strings.TrimPrefix(d.OrigName, "a/")
+		}
+		for _, h := range d.Hunks {
+			changes[name] = append(changes[name], headLines(h, h))
+		}
+	}
+	return changes, nil
+}
+
+// filter returns the hunks that overlap a hunk of the commit. The head of the
+// PR is the commit, so the hunks of both diffs are compared by their lines in
+// the files at the head.
+func (l latestChanges) filter(hunks []Hunk) []Hunk {
+	var filtered []Hunk
+	for _, h := range hunks {
+		name := h.headRelFile
+		if name == "/dev/null" {
+			name = h.relFile
+		}
+		lines := headLines(h.hunk, cmp.Or(h.lastHunk, h.hunk))
+		for _, r := range l[name] {
+			if r[0] <= lines[1] && lines[0] <= r[1] {
+				filtered = append(filtered, h)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// headLines returns the first and last lines of the diff hunks first to last
+// in the file at the head of the diff. The hunks only removing lines span the
+// line they precede.
+func headLines(first, last *diff.Hunk) [2]int {
+	return [2]int{int(first.NewStartLine), int(last.NewStartLine) + max(int(last.NewLines), 1) - 1}
+}
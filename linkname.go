@@ -0,0 +1,70 @@
+package main
+
+import (
+	"go/ast"
+	"go/types"
+	"strings"
+)
+
+// linkname is a //go:linkname directive of a package, linking its function
+// local to the function target of another package, in the form
+// importpath.name.
+type linkname struct {
+	pkg    *types.Package
+	local  string
+	target string
+}
+
+// linknameDirectives returns the //go:linkname directives in the comments of
+// f, a file of pkg. Directives without a target are omitted.
+func linknameDirectives(pkg *types.Package, f *ast.File) []linkname {
+	var links []linkname
+	for _, group := range f.Comments {
+		for _, c := range group.List {
+			rest, ok := strings.CutPrefix(c.Text, "//go:linkname ")
+			if !ok {
+				continue
+			}
+			if fields := strings.Fields(rest); len(fields) == 2 {
+				links = append(links, linkname{pkg: pkg, local: fields[0], target: fields[1]})
+			}
+		}
+	}
+	return links
+}
+
+// linkFuncs records the functions linked by the //go:linkname directives of
+// the loaded packages. Calls of a function declared without a body are
+// followed into the function with a body linked to it, whichever of the two
+// declares the directive.
+func (s *analyzerState) linkFuncs() {
+	byName := make(map[string]*types.Func)
+	for f := range s.funcs {
+		if f.Pkg() != nil && f.Type().(*types.Signature).Recv() == nil {
+			byName[f.Pkg().Path()+"."+f.Name()] = f
+		}
+	}
+	s.linked = make(map[*types.Func][]*types.Func)
+	for _, l := range s.linknames {
+		local, _ := l.pkg.Scope().Lookup(l.local).(*types.Func)
+		localInf, ok := s.funcs[local]
+		target := byName[l.target]
+		if !ok || target == nil {
+			continue
+		}
+		if localInf.fun.Body == nil {
+			s.linked[local] = append(s.linked[local], target)
+		} else if s.funcs[target].fun.Body == nil {
+			s.linked[target] = append(s.linked[target], local)
+		}
+	}
+}
+
+// linkedCallees resolves calls of functions without a body to the functions
+// linked to them by //go:linkname directives.
+func (s *analyzerState) linkedCallees(call *ast.CallExpr, info *types.Info) []*types.Func {
+	if f := calledFunc(info, call); f != nil {
+		return s.linked[f]
+	}
+	return nil
+}
@@ -8,19 +8,30 @@
 //
 //	example.com/pkg/path.Function
 //
+// A method of an interface type stands for the methods of its implementations.
+//
 // If the PR touches one or more callstacks, they're posted in a comment on the PR (once).
+//
+// Alternatively, the changes between two source trees given by `-old-dir` and `-new-dir` are checked
+// and the findings printed.
 package main
 
 import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"go/token"
+	"html"
+	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 
@@ -29,113 +40,1097 @@ import (
 )
 
 var (
-	dir        = flag.String("dir", ".", "base directory for the patch")
-	ghtoken    = flag.String("ghtoken", "", "the GitHub API token")
-	apiurl     = flag.String("apiurl", "https://api.github.com", "GitHub API URL")
-	repository = flag.String("repository", "", "the GitHub owner/repository")
-	prnum      = flag.Int("pr", 0, "the GitHub pull request number")
-	rootNames  = stringSlice{}
+	dir             = flag.String("dir", ".", "base directory for the patch")
+	ghtoken         = flag.String("ghtoken", "", "the GitHub API token")
+	apiurl          = flag.String("apiurl", "https://api.github.com", "GitHub API URL")
+	repository      = flag.String("repository", "", "the GitHub owner/repository")
+	baseline        = flag.String("baseline", "", "file of finding fingerprints to suppress")
+	writeBase       = flag.Bool("write-baseline", false, "write the findings to the -baseline file and exit")
+	userAgent       = flag.String("user-agent", "consensuswarn/"+versionString(), "the User-Agent of GitHub API requests")
+	noComment       = flag.Bool("no-comment", false, "print the findings instead of commenting on the PR")
+	failThreshold   = flag.Int("fail-threshold", -1, "exit with code 3 only if there are more findings than this number, whether they are posted or printed, or -1 to fail on printed findings only")
+	toolchain       = flag.String("toolchain", "", "the Go toolchain loading the packages, such as go1.22.2, as by GOTOOLCHAIN; the default follows the go and toolchain lines of go.mod")
+	oncePerFunc     = flag.Bool("comment-once-per-function", false, "anchor the comment on the changes of a touched function at its first changed line alone, rather than at the lines of its last hunk, in the inline and review comment modes")
+	codeowners      = flag.Bool("codeowners", false, "annotate the findings with the owners of their files in the CODEOWNERS file of -dir")
+	label           = flag.String("label", "", "a label to add to the PR if it has findings and to remove otherwise, in addition to the comments; ignored with -no-comment")
+	format          = flag.String("format", "text", "the format of printed findings: \"text\", \"junit\", \"dot\", \"json\" or \"html\"")
+	linkCommit      = flag.String("source-commit", "", "with -format html, the commit of -dir on GitHub that the findings link to; the default is the base commit of the PR, or its head with -tree-at-head")
+	debug           = flag.Bool("debug", false, "print debugging messages")
+	progress        = flag.String("progress", "auto", "print progress messages: \"on\", \"off\", or \"auto\" for a terminal in the text format")
+	validate        = flag.Bool("validate", false, "check that the roots resolve in -dir and exit")
+	dumpRoots       = flag.Bool("dump-roots", false, "print the resolved roots as JSON and exit")
+	listSymbols     = flag.Bool("list-changed-symbols", false, "print the functions and methods of the packages under -dir changed by the PR, whether or not they are reachable, and exit")
+	listFiles       = flag.Bool("list-reachable-files", false, "print the files declaring functions reachable from the roots and exit")
+	lang            = flag.String("lang", "en", "the language of the posted comments: "+strings.Join(languageTags(), ", "))
+	commentMode     = flag.String("comment-mode", "inline", "how findings are posted: \"inline\" for a review comment per finding, \"review\" for a single review, \"table\" for a summary comment, \"check-run\" for a check run of the head commit with an annotation per finding, which requires a GitHub App token")
+	maxFrames       = flag.Int("max-frames", 20, "the maximum number of frames of a call sequence in a comment, or 0 for no limit")
+	ignoreSpace     = flag.Bool("ignore-whitespace", false, "ignore changes to whitespace")
+	ignoreComments  = flag.Bool("ignore-comments", false, "ignore changes to comments")
+	minChanged      = flag.Int("min-changed-lines", 1, "the minimum number of added and removed lines of a reported hunk")
+	oldDir          = flag.String("old-dir", "", "check the changes from this source tree to -new-dir instead of a PR")
+	newDir          = flag.String("new-dir", "", "the changed source tree for -old-dir")
+	includeTests    = flag.Bool("include-test-files", false, "report changes to _test.go files")
+	treeAtHead      = flag.Bool("tree-at-head", false, "-dir holds the files at the head of the PR rather than at its base, as when CI checks out the head; the lines of the diff are remapped to them")
+	reportUnreached = flag.Bool("report-unreached", false, "also print the changes to Go files that are not reachable from any root")
+	jsonAllHunks    = flag.Bool("json-all-hunks", false, "with -format json, also list every hunk of the Go files of the loaded packages with whether it is reachable")
+	softTimeout     = flag.Duration("soft-timeout", 0, "stop walking the roots this long after the start of the check of a patch, not counting the loading of the packages, and report the findings so far as partial, rather than failing, or 0 for no limit")
+	mergeDelay      = flag.Duration("mergeable-delay", time.Second, "the initial delay between checks for the mergeability of the PR")
+	mergeFactor     = flag.Float64("mergeable-factor", 2, "the factor by which the delay between mergeability checks grows")
+	mergeRetries    = flag.Int("mergeable-retries", 6, "the maximum number of repeated mergeability checks")
+	mergeMaxWait    = flag.Duration("mergeable-max-wait", 0, "the maximum total wait for the mergeability of the PR, or 0 for no limit")
+	detectGlobals   = flag.Bool("detect-globals", false, "report the package-level variables written by the changes")
+	diffRetries     = flag.Int("diff-retries", 3, "the maximum number of repeated downloads of the diff after server errors")
+	diffDelay       = flag.Duration("diff-delay", time.Second, "the initial delay between downloads of the diff, doubling after every attempt")
+	history         = flag.Bool("history", false, "check the PRs without commenting and print a summary of the findings, for calibrating the roots")
+	mergeCommit     = flag.Bool("merge-commit", false, "check the diff of the test merge commit of the PR from its base rather than the PR diff")
+	pushCommit      = flag.String("commit", "", "check the changes of this pushed commit from its first parent instead of a PR, and comment on the commit")
+	latestOnly      = flag.Bool("latest-commit-only", false, "only report the changes introduced by the head commit of the PR")
+	strict          = flag.Bool("strict", false, "also print the calls from reachable functions that cannot be resolved")
+	printVersion    = flag.Bool("version", false, "print the version and exit")
+	prNumbers       = intSlice{}
+	rootNames       = stringSlice{}
+	hookSpecs       = stringSlice{}
+	edgeSpecs       = stringSlice{}
+	goosList        = stringSlice{}
+	disabledRoots   = stringSlice{}
+	publicPackages  = stringSlice{}
+	headers         = headerFlag{}
+	loadVars        = envFlag{}
+	rootMessages    = rootMessageFlag{}
+)
+
+// prnum is the number of the pull request being checked.
+var prnum = new(int)
+
+// The build metadata of consensuswarn, set with
+//
+//	go build -ldflags "-X main.version=v1.2.3 -X main.commit=$(git rev-parse HEAD) -X main.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version = "devel"
+	commit  = "unknown"
+	date    = "unknown"
 )
 
+// versionString formats the build metadata as "version (commit; date)".
+func versionString() string {
+	return fmt.Sprintf("%s (%s; %s)", version, commit, date)
+}
+
+// commentTitle is the English title of the comments. It also identifies the
+// comments posted by earlier versions, which lack markers.
 const commentTitle = "Change potentially affects state."
 
 func init() {
+	flag.Var(&prNumbers, "pr", "comma-separated list of GitHub pull request numbers")
 	flag.Var(&rootNames, "roots", "comma-separated list of root functions")
+	flag.Var(&hookSpecs, "hooks", "comma-separated list of register=extract function pairs for callbacks")
+	flag.Var(headers, "header", "a key=value header to set on every GitHub request; may be repeated")
+	flag.Var(&loadVars, "env", "a KEY=VALUE environment variable of the go command loading the packages, such as GOPRIVATE; may be repeated")
+	flag.Var(&disabledRoots, "disable-roots", "comma-separated list of roots, with their full package paths, to leave out of the check")
+	flag.Var(&publicPackages, "public-api", "comma-separated list of package paths whose exported functions and methods of exported types are roots, for the impact of a change on their API")
+	flag.Var(&goosList, "goos", "comma-separated list of platforms to load the packages for, as by GOOS; with several, the findings for every platform are united")
+	flag.Var(rootMessages, "root-message", "a root=message title of the findings reachable from the root, such as its concern; may be repeated")
+	flag.Var(&edgeSpecs, "exclude-edges", "comma-separated list of caller->callee calls to exclude from the call graph")
 }
 
 func main() {
 	flag.Parse()
-	if *prnum <= 0 {
-		fmt.Fprintf(os.Stderr, "consensuswarn: invalid PR number: %d\n", *prnum)
-		os.Exit(1)
+	if *printVersion {
+		fmt.Printf("consensuswarn %s\n", versionString())
+		os.Exit(0)
+	}
+	if *validate {
+		*dir = resolveDir(*dir)
+		os.Exit(validateRoots(context.Background()))
+	}
+	if *dumpRoots {
+		*dir = resolveDir(*dir)
+		os.Exit(dumpResolvedRoots(context.Background(), os.Stdout))
+	}
+	if *listFiles {
+		*dir = resolveDir(*dir)
+		os.Exit(listReachableFiles(context.Background(), os.Stdout))
+	}
+	switch *format {
+	case "text", "junit", "dot", "json", "html":
+	default:
+		fmt.Fprintf(os.Stderr, "consensuswarn: invalid format: %s\n", *format)
+		os.Exit(exitUsage)
+	}
+	if *failThreshold < -1 {
+		fmt.Fprintf(os.Stderr, "consensuswarn: invalid fail threshold: %d\n", *failThreshold)
+		os.Exit(exitUsage)
+	}
+	if *minChanged < 0 {
+		fmt.Fprintf(os.Stderr, "consensuswarn: invalid minimum of changed lines: %d\n", *minChanged)
+		os.Exit(exitUsage)
+	}
+	switch *progress {
+	case "auto", "on", "off":
+	default:
+		fmt.Fprintf(os.Stderr, "consensuswarn: invalid progress mode: %s\n", *progress)
+		os.Exit(exitUsage)
+	}
+	if *oldDir != "" || *newDir != "" {
+		os.Exit(checkSnapshots(context.Background()))
+	}
+	if len(prNumbers) == 0 && *pushCommit == "" {
+		fmt.Fprint(os.Stderr, "consensuswarn: no PR number\n")
+		os.Exit(exitUsage)
+	}
+	if len(prNumbers) > 0 && *pushCommit != "" {
+		fmt.Fprint(os.Stderr, "consensuswarn: -commit excludes -pr\n")
+		os.Exit(exitUsage)
+	}
+	for _, n := range prNumbers {
+		if n <= 0 {
+			fmt.Fprintf(os.Stderr, "consensuswarn: invalid PR number: %d\n", n)
+			os.Exit(exitUsage)
+		}
+	}
+	if *writeBase && *baseline == "" {
+		fmt.Fprint(os.Stderr, "consensuswarn: -write-baseline requires -baseline\n")
+		os.Exit(exitUsage)
 	}
-	*dir, _ = filepath.Abs(*dir)
+	if *writeBase && len(prNumbers) > 1 {
+		fmt.Fprint(os.Stderr, "consensuswarn: -write-baseline requires a single PR\n")
+		os.Exit(exitUsage)
+	}
+	if _, ok := languages[*lang]; !ok {
+		fmt.Fprintf(os.Stderr, "consensuswarn: unsupported language: %s\n", *lang)
+		os.Exit(exitUsage)
+	}
+	switch *commentMode {
+	case "inline", "review", "table", "check-run":
+	default:
+		fmt.Fprintf(os.Stderr, "consensuswarn: invalid comment mode: %s\n", *commentMode)
+		os.Exit(exitUsage)
+	}
+	base, err := apiBaseURL(*apiurl)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "consensuswarn: invalid API URL: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	*dir = resolveDir(*dir)
 
 	ctx := context.Background()
-	var ts oauth2.TokenSource
-	if *ghtoken != "" {
-		ts = oauth2.StaticTokenSource(
-			&oauth2.Token{AccessToken: *ghtoken},
-		)
+	gh := newClient(ctx, *ghtoken, *userAgent, http.Header(headers))
+	gh.BaseURL = base
+	os.Exit(run(ctx, gh))
+}
+
+// Exit codes.
+const (
+	exitOK = 0
+	// exitUsage is returned for invalid flags.
+	exitUsage = 1
+	// exitError is returned when the check could not be completed.
+	exitError = 2
+	// exitFindings is returned when findings are reported locally instead of
+	// being posted, or when they exceed the -fail-threshold.
+	exitFindings = 3
+)
+
+// findingsCode returns the exit code of the process for n findings, which were
+// posted or printed. Without a -fail-threshold, only printed findings fail.
+func findingsCode(n int, posted bool) int {
+	fail := n > 0 && !posted
+	if *failThreshold >= 0 {
+		fail = n > *failThreshold
 	}
-	tc := oauth2.NewClient(ctx, ts)
-	gh := github.NewClient(tc)
+	if fail {
+		return exitFindings
+	}
+	return exitOK
+}
+
+// run checks the pull requests and reports the findings as configured by the
+// flags. The packages are loaded once for all pull requests. It returns the
+// exit code of the process, exitError if any check failed.
+func run(ctx context.Context, gh *github.Client) int {
+	opts, err := checkOptionsFromFlags()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "consensuswarn: %v\n", err)
+		return exitUsage
+	}
+	c := newChecker(*dir, opts)
+	if *history {
+		return runHistory(ctx, gh, c, os.Stdout)
+	}
+	if *pushCommit != "" {
+		return runPush(ctx, gh, c)
+	}
+	code := exitOK
+	for _, n := range prNumbers {
+		*prnum = n
+		switch runPR(ctx, gh, c) {
+		case exitError:
+			code = exitError
+		case exitFindings:
+			if code == exitOK {
+				code = exitFindings
+			}
+		}
+	}
+	return code
+}
+
+// runPR checks the pull request numbered *prnum with c and reports the
+// findings. It returns the exit code of the process.
+func runPR(ctx context.Context, gh *github.Client, c *checker) int {
 	split := strings.SplitN(*repository, "/", 2)
 	owner, repo := split[0], split[1]
 	pr, patch, err := getDiff(ctx, gh, owner, repo)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "consensuswarn: %v\n", err)
-		os.Exit(2)
+		return exitError
+	}
+	if fork := pr.GetHead().GetRepo().GetFullName(); fork != "" && fork != *repository && *debug {
+		fmt.Fprintf(os.Stderr, "consensuswarn: PR %d is from the fork %s; checking and commenting on %s\n", *prnum, fork, *repository)
+	}
+	sourceCommit = pr.GetBase().GetSHA()
+	if *treeAtHead {
+		sourceCommit = pr.GetHead().GetSHA()
+	}
+	if *listSymbols {
+		return printChangedSymbols(ctx, os.Stdout, c, patch)
 	}
-	notified, err := hasComment(ctx, gh, owner, repo)
+	// An already commented PR is still checked to update its label. Check
+	// runs are updated on every check.
+	commented := false
+	if !*noComment && *commentMode != "check-run" {
+		notified, err := hasComment(ctx, gh, owner, repo)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "consensuswarn: %v\n", err)
+			return exitError
+		}
+		commented = notified && !*writeBase
+		if commented && *label == "" && *failThreshold < 0 {
+			fmt.Fprintf(os.Stderr, "consensuswarn: ignoring PR %d because it was already commented\n", *prnum)
+			return exitOK
+		}
+	}
+	if !pr.GetMergeable() {
+		fmt.Fprintf(os.Stderr, "consensuswarn: ignoring non-mergeable PR %d\n", *prnum)
+		return exitOK
+	}
+
+	fset := c.fset
+	res, err := c.findings(ctx, patch)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "consensuswarn: %v\n", err)
-		os.Exit(2)
+		return exitError
 	}
-	if notified {
-		fmt.Fprint(os.Stderr, "consensuswarn: ignoring PR because it was already commented\n")
-		os.Exit(0)
+	if *latestOnly {
+		latest, err := getLatestChanges(ctx, gh, owner, repo, pr.GetHead().GetSHA())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "consensuswarn: %v\n", err)
+			return exitError
+		}
+		res.hunks = latest.filter(res.hunks)
 	}
-	if !pr.GetMergeable() {
-		fmt.Fprint(os.Stderr, "consensuswarn: ignoring non-mergeable PR\n")
-		os.Exit(0)
+	hunks := res.hunks
+	if *writeBase {
+		if err := writeBaseline(*baseline, hunks); err != nil {
+			fmt.Fprintf(os.Stderr, "consensuswarn: %v\n", err)
+			return exitError
+		}
+		return exitOK
+	}
+	// Nothing is written to the PR with -no-comment, not even the label.
+	if *noComment {
+		return printFindings(os.Stdout, fset, res)
 	}
+	if *label != "" {
+		if err := syncLabel(ctx, gh, owner, repo, pr, *label, len(hunks) > 0); err != nil {
+			fmt.Fprintf(os.Stderr, "consensuswarn: %v\n", err)
+			return exitError
+		}
+	}
+	if commented {
+		fmt.Fprintf(os.Stderr, "consensuswarn: not commenting on PR %d because it was already commented\n", *prnum)
+		return findingsCode(len(hunks), true)
+	}
+	if err := postFindings(ctx, gh, owner, repo, pr, fset, hunks); err != nil {
+		// Tokens of PRs from forks may be read-only.
+		if isForbidden(err) {
+			fmt.Fprintf(os.Stderr, "consensuswarn: no permission to comment on PR %d, printing the findings instead: %v\n", *prnum, err)
+			return printFindings(os.Stdout, fset, res)
+		}
+		fmt.Fprintf(os.Stderr, "consensuswarn: %v\n", err)
+		return exitError
+	}
+	return findingsCode(len(hunks), true)
+}
 
-	fset := new(token.FileSet)
-	hunks, err := runCheck(fset, *dir, patch, rootNames)
+// printChangedSymbols writes the functions and methods of the packages loaded
+// by c that are changed by patch to w, one per line. With -list-changed-symbols,
+// c loads every package under -dir. It returns the exit code of the process.
+func printChangedSymbols(ctx context.Context, w io.Writer, c *checker, patch io.Reader) int {
+	if err := c.load(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "consensuswarn: %v\n", err)
+		return exitError
+	}
+	var names []string
+	var err error
+	if len(c.variants) > 0 {
+		names, err = c.variantSymbols(patch)
+	} else {
+		names, err = c.prog.changedSymbols(c.dir, patch, c.opts)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "consensuswarn: %v\n", err)
-		os.Exit(2)
+		return exitError
+	}
+	for _, name := range names {
+		fmt.Fprintln(w, name)
+	}
+	return exitOK
+}
+
+// postFindings comments on the PR about the findings for hunks as configured
+// by -comment-mode, skipping or updating the findings already commented.
+func postFindings(ctx context.Context, gh *github.Client, owner, repo string, pr *github.PullRequest, fset *token.FileSet, hunks []Hunk) error {
+	if *commentMode == "table" {
+		if len(hunks) == 0 {
+			return nil
+		}
+		body := summaryTable(fset, hunks)
+		_, _, err := gh.Issues.CreateComment(ctx, owner, repo, *prnum, &github.IssueComment{Body: &body})
+		return err
+	}
+	// The head commit of a PR from a fork is kept by the base repository
+	// under refs/pull/<number>/head, so it is valid for review comments on
+	// the base repository.
+	commit := pr.GetHead().GetSHA()
+	if commit == "" {
+		return fmt.Errorf("PR %d has no head commit", *prnum)
+	}
+	if *commentMode == "check-run" {
+		return postCheckRun(ctx, gh, owner, repo, commit, fset, hunks)
 	}
 	comments, err := getReviewComments(ctx, gh, owner, repo)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "consensuswarn: %v\n", err)
-		os.Exit(2)
+		return err
 	}
+	var pending []reviewComment
 	for _, hunk := range hunks {
 		path := hunk.relFile
-		line := int(hunk.hunk.OrigStartLine + hunk.hunk.OrigLines)
-		if comments[commentKey{path, line}] {
+		startLine, line := hunk.commentLines()
+		if *oncePerFunc {
+			startLine, line = 0, hunk.changes[0].line
+		}
+		body := postedCommentBody(fset, &hunk, *maxFrames)
+		if prev, ok := comments.fingerprints[hunk.fingerprint()]; ok {
+			// Update the comment in place to preserve its thread.
+			if prev.Body != body {
+				if err := updateReviewComment(ctx, gh, owner, repo, prev.ID, body); err != nil {
+					return err
+				}
+			}
 			continue
 		}
-		comment := new(bytes.Buffer)
-		fmt.Fprintf(comment, "%s\n\nCall sequence:\n", commentTitle)
-		fmt.Fprintf(comment, "```\n")
-		for i := len(hunk.stack) - 1; i >= 0; i-- {
-			e := hunk.stack[i]
-			pos := fset.Position(e.pos)
-			fmt.Fprintf(comment, "%s (%s:%d)\n", e.fun.FullName(), hunk.relFile, pos.Line)
+		if comments.lines[commentKey{path, line}] {
+			continue
 		}
-		fmt.Fprintf(comment, "```\n")
-		err := postReviewComment(ctx, gh, owner, repo, &reviewComment{
-			CommitID:  *pr.Head.SHA,
-			StartLine: int(hunk.hunk.OrigStartLine),
+		pending = append(pending, reviewComment{
+			CommitID:  commit,
+			StartLine: startLine,
 			Line:      line,
 			Path:      path,
-			Body:      comment.String(),
+			Body:      body,
 		})
+	}
+	if *commentMode == "review" {
+		if len(pending) == 0 {
+			return nil
+		}
+		review := &pullReview{
+			CommitID: commit,
+			Body:     text().Title + "\n\n" + commentMarker + "\n",
+			Event:    "COMMENT",
+		}
+		for _, c := range pending {
+			c.CommitID = ""
+			review.Comments = append(review.Comments, c)
+		}
+		if err := postReview(ctx, gh, owner, repo, review); err != nil {
+			return err
+		}
+		return nil
+	}
+	for i := range pending {
+		if err := postReviewComment(ctx, gh, owner, repo, &pending[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isForbidden reports whether err is a GitHub API error for a request without
+// permission, such as a comment with a read-only token.
+func isForbidden(err error) bool {
+	var errResp *github.ErrorResponse
+	return errors.As(err, &errResp) && errResp.Response != nil && errResp.Response.StatusCode == http.StatusForbidden
+}
+
+// checkOptionsFromFlags returns the check options configured by the flags.
+func checkOptionsFromFlags() (checkOptions, error) {
+	opts := checkOptions{
+		ignoreWhitespace: *ignoreSpace,
+		minChangedLines:  *minChanged,
+		ignoreComments:   *ignoreComments,
+		includeTestFiles: *includeTests,
+		reportUnreached:  *reportUnreached || *jsonAllHunks && *format == "json",
+		globals:          *detectGlobals,
+		strict:           *strict,
+		env:              loadVars,
+		everyRoot:        len(rootMessages) > 0 || *history || *format == "junit" || *format == "json",
+		treeAtHead:       *treeAtHead,
+		publicAPI:        publicPackages,
+		softTimeout:      *softTimeout,
+		allPackages:      *listSymbols,
+		resolvers:        slices.Clone(registeredResolvers),
+	}
+	if *toolchain != "" {
+		// The last value wins, overriding -env and the environment.
+		opts.env = append(slices.Clip(opts.env), "GOTOOLCHAIN="+*toolchain)
+	}
+	for _, spec := range hookSpecs {
+		h, err := parseHook(spec)
+		if err != nil {
+			return checkOptions{}, err
+		}
+		opts.hooks = append(opts.hooks, h)
+	}
+	for _, root := range disabledRoots {
+		f, _, err := parseRoot(root)
+		if err != nil {
+			return checkOptions{}, err
+		}
+		opts.disabledRoots = append(opts.disabledRoots, f)
+	}
+	for _, spec := range edgeSpecs {
+		e, err := parseEdge(spec)
+		if err != nil {
+			return checkOptions{}, err
+		}
+		opts.excludeEdges = append(opts.excludeEdges, e)
+	}
+	if showProgress(*progress, *format, isTerminal(os.Stderr)) {
+		opts.progressf = func(format string, args ...any) {
+			fmt.Fprintf(os.Stderr, "consensuswarn: "+format+"\n", args...)
+		}
+	}
+	if *debug {
+		opts.logf = func(format string, args ...any) {
+			fmt.Fprintf(os.Stderr, "consensuswarn: "+format+"\n", args...)
+		}
+	}
+	return opts, nil
+}
+
+// showProgress reports whether progress is printed for the -progress mode
+// and the -format. In the auto mode, progress is only printed in the text
+// format to a terminal.
+func showProgress(mode, format string, terminal bool) bool {
+	switch mode {
+	case "on":
+		return true
+	case "auto":
+		return terminal && format == "text"
+	}
+	return false
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// checker checks patches against the packages of the roots in dir, which are
+// loaded on first use.
+type checker struct {
+	fset *token.FileSet
+	dir  string
+	opts checkOptions
+	prog *program
+	// goos is the platform of a variant.
+	goos string
+	// variants check the patches for each of several platforms in place of
+	// the checker, which loads no packages itself.
+	variants []*checker
+}
+
+// loadProgram loads the packages for a checker.
+var loadProgram = load
+
+// load loads the packages of c unless they are loaded.
+func (c *checker) load(ctx context.Context) error {
+	for _, v := range c.variants {
+		if err := v.load(ctx); err != nil {
+			return fmt.Errorf("GOOS=%s: %w", v.goos, err)
+		}
+	}
+	if c.prog != nil || len(c.variants) > 0 {
+		return nil
+	}
+	prog, err := loadProgram(ctx, c.fset, c.dir, rootNames, c.opts)
+	if err != nil {
+		return err
+	}
+	c.prog = prog
+	return nil
+}
+
+// findings checks patch and returns the findings that are neither excluded
+// by the ignore file nor, unless it is being written, suppressed by the
+// baseline.
+func (c *checker) findings(ctx context.Context, patch io.Reader) (*checkResult, error) {
+	// Patches without Go changes are not worth loading the packages for.
+	data, err := io.ReadAll(patch)
+	if err != nil {
+		return nil, err
+	}
+	if p, err := parsePatch(c.dir, bytes.NewReader(data)); err == nil && !p.changesGo(c.opts) {
+		fmt.Fprint(os.Stderr, "consensuswarn: no Go files changed, skipping the analysis\n")
+		return &checkResult{}, nil
+	}
+	patch = bytes.NewReader(data)
+	if err := c.load(ctx); err != nil {
+		return nil, err
+	}
+	if len(c.variants) > 0 {
+		return c.variantFindings(ctx, patch)
+	}
+	res, err := c.prog.check(ctx, c.dir, patch, c.opts)
+	if err != nil {
+		return nil, err
+	}
+	if res.partial {
+		fmt.Fprintf(os.Stderr, "consensuswarn: the -soft-timeout of %v passed, the findings are partial\n", *softTimeout)
+	}
+	ignored, err := readIgnoreFile(c.dir)
+	if err != nil {
+		return nil, err
+	}
+	res.hunks = ignored.filter(res.hunks)
+	res.unreached = ignored.filter(res.unreached)
+	res.acknowledged = ignored.filter(res.acknowledged)
+	if *baseline != "" && !*writeBase {
+		suppressed, err := readBaseline(*baseline)
+		if err != nil {
+			return nil, err
+		}
+		res.hunks = filterBaseline(res.hunks, suppressed)
+	}
+	if *codeowners {
+		owners, err := readCodeOwners(c.dir)
+		if err != nil {
+			return nil, err
+		}
+		owners.annotate(res.hunks)
+		owners.annotate(res.acknowledged)
+	}
+	return res, nil
+}
+
+// printFindings writes the findings of res to w in the -format, followed by
+// the unreached hunks for the text format. It returns the exit code of the
+// process.
+func printFindings(w io.Writer, fset *token.FileSet, res *checkResult) int {
+	sortHunks(res.hunks)
+	sortHunks(res.acknowledged)
+	sortHunks(res.unreached)
+	var err error
+	switch *format {
+	case "junit":
+		err = writeJUnit(w, fset, res)
+	case "dot":
+		err = writeDot(w, res)
+	case "json":
+		err = writeJSON(w, fset, *dir, res)
+	case "html":
+		err = writeHTML(w, fset, *dir, res)
+	default:
+		printText(w, fset, res)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "consensuswarn: %v\n", err)
+		return exitError
+	}
+	// Blind spots fail regardless of the -fail-threshold and the -format.
+	if len(res.blindSpots) > 0 {
+		return exitFindings
+	}
+	return findingsCode(len(res.hunks), false)
+}
+
+// printText writes the findings, acknowledged and unreached hunks and blind
+// spots of res to w as text.
+func printText(w io.Writer, fset *token.FileSet, res *checkResult) {
+	for _, hunk := range res.hunks {
+		fmt.Fprintf(w, "%s:%d: %s", hunk.relFile, hunk.startLine, commentBody(fset, &hunk, *maxFrames))
+	}
+	for _, hunk := range res.acknowledged {
+		reason := hunk.reason
+		if reason == "" {
+			reason = "no reason given"
+		}
+		fmt.Fprintf(w, "%s:%d: acknowledged change reachable from %s: %s\n", hunk.relFile, hunk.startLine, hunk.stack[0].fun.FullName(), reason)
+	}
+	for _, hunk := range res.unreached {
+		fmt.Fprintf(w, "%s:%d: not reachable from any root\n", hunk.relFile, hunk.startLine)
+	}
+	for _, spot := range res.blindSpots {
+		fmt.Fprintf(w, "%s:%d: unresolved %s in %s\n", spot.relFile, spot.pos.Line, spot.reason, spot.caller.FullName())
+	}
+}
+
+// checkSnapshots checks the changes between the -old-dir and -new-dir source
+// trees and prints the findings. It returns the exit code of the process.
+func checkSnapshots(ctx context.Context) int {
+	if *oldDir == "" || *newDir == "" {
+		fmt.Fprint(os.Stderr, "consensuswarn: -old-dir and -new-dir must be specified together\n")
+		return exitUsage
+	}
+	opts, err := checkOptionsFromFlags()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "consensuswarn: %v\n", err)
+		return exitUsage
+	}
+	old := resolveDir(*oldDir)
+	patch, err := diffTrees(old, *newDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "consensuswarn: %v\n", err)
+		return exitError
+	}
+	c := newChecker(old, opts)
+	res, err := c.findings(ctx, bytes.NewReader(patch))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "consensuswarn: %v\n", err)
+		return exitError
+	}
+	return printFindings(os.Stdout, c.fset, res)
+}
+
+// resolveDir returns the absolute path of dir with symbolic links resolved,
+// or just the absolute path if dir cannot be resolved. The packages are loaded
+// from the resolved directory so that the positions of their files match the
+// paths of the patch relative to it.
+func resolveDir(dir string) string {
+	abs, _ := filepath.Abs(dir)
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved
+	}
+	return abs
+}
+
+// validateRoots loads the packages of the roots and reports whether every
+// root is found. It returns the exit code of the process.
+func validateRoots(ctx context.Context) int {
+	opts, err := checkOptionsFromFlags()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "consensuswarn: %v\n", err)
+		return exitUsage
+	}
+	if err := newChecker(*dir, opts).load(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "consensuswarn: %v\n", err)
+		return exitError
+	}
+	fmt.Fprintf(os.Stderr, "consensuswarn: all %d roots resolved\n", len(rootNames))
+	return exitOK
+}
+
+// resolvedRoot is the JSON description of a resolved root.
+type resolvedRoot struct {
+	Name string `json:"name"`
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+// dumpResolvedRoots writes the resolved roots as JSON to w, sorted by name. It
+// returns the exit code of the process.
+func dumpResolvedRoots(ctx context.Context, w io.Writer) int {
+	opts, err := checkOptionsFromFlags()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "consensuswarn: %v\n", err)
+		return exitUsage
+	}
+	c := newChecker(*dir, opts)
+	if err := c.load(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "consensuswarn: %v\n", err)
+		return exitError
+	}
+	// With several platforms, a root is described as resolved for the
+	// first of them.
+	roots := []resolvedRoot{}
+	resolved := make(map[string]bool)
+	for _, prog := range c.programs() {
+		for _, root := range prog.roots {
+			if resolved[root.FullName()] {
+				continue
+			}
+			resolved[root.FullName()] = true
+			pos := c.fset.Position(root.Pos())
+			file := pos.Filename
+			if rel, err := filepath.Rel(*dir, file); err == nil {
+				file = filepath.ToSlash(rel)
+			}
+			roots = append(roots, resolvedRoot{Name: root.FullName(), File: file, Line: pos.Line})
+		}
+	}
+	sort.Slice(roots, func(i, j int) bool {
+		return roots[i].Name < roots[j].Name
+	})
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	if err := enc.Encode(roots); err != nil {
+		fmt.Fprintf(os.Stderr, "consensuswarn: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// listReachableFiles writes the files of -dir that declare a function reachable
+// from the roots to w, one per line. It returns the exit code of the process.
+func listReachableFiles(ctx context.Context, w io.Writer) int {
+	opts, err := checkOptionsFromFlags()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "consensuswarn: %v\n", err)
+		return exitUsage
+	}
+	c := newChecker(*dir, opts)
+	if err := c.load(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "consensuswarn: %v\n", err)
+		return exitError
+	}
+	var files []string
+	for _, prog := range c.programs() {
+		pfiles, err := prog.reachableFiles(ctx, *dir, opts)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "consensuswarn: %v\n", err)
-			os.Exit(2)
+			return exitError
 		}
+		files = append(files, pfiles...)
+	}
+	slices.Sort(files)
+	files = slices.Compact(files)
+	for _, file := range files {
+		fmt.Fprintln(w, file)
 	}
+	return exitOK
+}
+
+// commentBody renders the comment describing the finding for hunk. Call
+// sequences longer than maxFrames are shortened by omitting the middle frames;
+// a maxFrames of zero or less means no limit.
+func commentBody(fset *token.FileSet, hunk *Hunk, maxFrames int) string {
+	text := text()
+	comment := new(bytes.Buffer)
+	fmt.Fprintf(comment, "%s\n\n%s\n", findingTitle(hunk), text.CallSequence)
+	fmt.Fprintf(comment, "```\n")
+	// The root and the touched function are always shown.
+	if maxFrames > 0 && maxFrames < 2 {
+		maxFrames = 2
+	}
+	omitted := 0
+	if maxFrames > 0 && len(hunk.stack) > maxFrames {
+		omitted = len(hunk.stack) - maxFrames
+	}
+	// Frames are printed from the touched function to the root; skip the
+	// omitted frames after the first half.
+	skipFrom := len(hunk.stack) - 1 - (maxFrames+1)/2
+	for i := len(hunk.stack) - 1; i >= 0; i-- {
+		if omitted > 0 && i == skipFrom {
+			fmt.Fprintf(comment, text.FramesOmittedf+"\n", omitted)
+			i -= omitted - 1
+			continue
+		}
+		e := hunk.stack[i]
+		pos := fset.Position(e.pos)
+		fmt.Fprintf(comment, "%s (%s:%d)\n", e.fun.FullName(), relFile(*dir, pos.Filename), pos.Line)
+	}
+	fmt.Fprintf(comment, "```\n")
+	if hunk.removes {
+		fmt.Fprintf(comment, "\n%s\n", text.Removes)
+	}
+	if len(hunk.globals) > 0 {
+		fmt.Fprintf(comment, "\n"+text.Globalsf+"\n", strings.Join(hunk.globals, "`, `"))
+	}
+	if len(hunk.cgoCalls) > 0 {
+		fmt.Fprintf(comment, "\n"+text.Cgof+"\n", strings.Join(hunk.cgoCalls, "`, `"))
+	}
+	if len(hunk.owners) > 0 {
+		fmt.Fprintf(comment, "\n"+text.Ownersf+"\n", strings.Join(hunk.owners, " "))
+	}
+	return comment.String()
+}
+
+// postedCommentBody renders the comment for hunk as posted to GitHub, with the
+// fingerprint of the finding embedded in a hidden marker.
+func postedCommentBody(fset *token.FileSet, hunk *Hunk, maxFrames int) string {
+	return commentBody(fset, hunk, maxFrames) + fmt.Sprintf("\n<!-- consensuswarn:fingerprint=%s -->\n", hunk.fingerprint())
+}
+
+// summaryTable renders a comment summarizing the findings for hunks in a
+// table, with the call sequence of each finding in a collapsed section. The
+// table is preceded by the number of findings and their roots by file.
+func summaryTable(fset *token.FileSet, hunks []Hunk) string {
+	text := text()
+	comment := new(bytes.Buffer)
+	fmt.Fprintf(comment, "%s\n\n", text.Title)
+	// Roll up the findings by file before detailing them.
+	var files []string
+	counts := make(map[string]int)
+	roots := make(map[string][]string)
+	owners := make(map[string][]string)
+	owned := false
+	for _, hunk := range hunks {
+		if counts[hunk.relFile] == 0 {
+			files = append(files, hunk.relFile)
+		}
+		counts[hunk.relFile]++
+		roots[hunk.relFile] = append(roots[hunk.relFile], hunk.rootName())
+		owners[hunk.relFile] = hunk.owners
+		owned = owned || len(hunk.owners) > 0
+	}
+	columns := text.FileColumns[:]
+	if owned {
+		columns = append(columns, text.OwnersColumn)
+	}
+	fmt.Fprintf(comment, "| %s |\n", strings.Join(columns, " | "))
+	fmt.Fprintf(comment, "|%s\n", strings.Repeat(" --- |", len(columns)))
+	for _, file := range files {
+		names := roots[file]
+		slices.Sort(names)
+		names = slices.Compact(names)
+		fmt.Fprintf(comment, "| `%s` | %d | `%s` |", file, counts[file], strings.Join(names, "`, `"))
+		if owned {
+			fmt.Fprintf(comment, " %s |", strings.Join(owners[file], " "))
+		}
+		fmt.Fprintf(comment, "\n")
+	}
+	fmt.Fprintf(comment, "\n| %s |\n", strings.Join(text.Columns[:], " | "))
+	fmt.Fprintf(comment, "| --- | --- | --- | --- | --- |\n")
+	for _, hunk := range hunks {
+		root := hunk.stack[0]
+		fmt.Fprintf(comment, "| `%s` | %d | `%s` | %d | <details><summary>"+text.Framesf+"</summary>", hunk.relFile, hunk.startLine, root.fun.FullName(), len(hunk.stack)-1, len(hunk.stack))
+		for i := len(hunk.stack) - 1; i >= 0; i-- {
+			e := hunk.stack[i]
+			if i < len(hunk.stack)-1 {
+				fmt.Fprintf(comment, "<br>")
+			}
+			pos := fset.Position(e.pos)
+			fmt.Fprintf(comment, "<code>%s</code> (%s:%d)", html.EscapeString(e.fun.FullName()), relFile(*dir, pos.Filename), pos.Line)
+		}
+		fmt.Fprintf(comment, "</details> |\n")
+	}
+	fmt.Fprintf(comment, "\n%s\n", commentMarker)
+	return comment.String()
+}
+
+// newClient returns a GitHub client authenticated by token, if any, that
+// identifies itself with userAgent and sets the additional header on every
+// request.
+func newClient(ctx context.Context, token, userAgent string, header http.Header) *github.Client {
+	var ts oauth2.TokenSource
+	if token != "" {
+		ts = oauth2.StaticTokenSource(
+			&oauth2.Token{AccessToken: token},
+		)
+	}
+	tc := oauth2.NewClient(ctx, ts)
+	// Wrap the transport rather than modifying tc, which may be the shared
+	// http.DefaultClient.
+	h := header.Clone()
+	if h == nil {
+		h = make(http.Header)
+	}
+	h.Set("User-Agent", userAgent)
+	hc := &http.Client{
+		Transport: &headerTransport{
+			header: h,
+			base:   tc.Transport,
+		},
+	}
+	gh := github.NewClient(hc)
+	gh.UserAgent = userAgent
+	return gh
+}
+
+// apiBaseURL parses the GitHub API URL raw, ending its path in exactly one
+// slash as the API client requires to resolve the endpoints.
+func apiBaseURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("%s is not an absolute URL", raw)
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + "/"
+	return u, nil
+}
+
+// apiEndpoint returns the URL of the API endpoint formatted from format and
+// args relative to the base URL of gh, whether or not it ends in a slash.
+func apiEndpoint(gh *github.Client, format string, args ...any) string {
+	return strings.TrimRight(gh.BaseURL.String(), "/") + "/" + fmt.Sprintf(format, args...)
+}
+
+// headerTransport sets headers on every request, including the requests not
+// built by the GitHub client.
+type headerTransport struct {
+	header http.Header
+	base   http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range t.header {
+		req.Header[k] = v
+	}
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
+
+// headerFlag is a repeated flag of key=value headers.
+type headerFlag http.Header
+
+func (h headerFlag) String() string {
+	var s []string
+	for k, vs := range h {
+		for _, v := range vs {
+			s = append(s, k+"="+v)
+		}
+	}
+	sort.Strings(s)
+	return strings.Join(s, ",")
+}
+
+func (h headerFlag) Set(flag string) error {
+	k, v, ok := strings.Cut(flag, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("malformed header: %s", flag)
+	}
+	http.Header(h).Add(k, v)
+	return nil
+}
+
+// envFlag is a repeated flag of KEY=VALUE environment variables.
+type envFlag []string
+
+func (e *envFlag) String() string {
+	return strings.Join(*e, ",")
+}
+
+func (e *envFlag) Set(flag string) error {
+	if k, _, ok := strings.Cut(flag, "="); !ok || k == "" {
+		return fmt.Errorf("malformed environment variable: %s", flag)
+	}
+	*e = append(*e, flag)
+	return nil
+}
+
+// rootMessageFlag is a repeated flag of root=message titles of the findings
+// reachable from the roots.
+type rootMessageFlag map[rootFunction]string
+
+func (m rootMessageFlag) String() string {
+	var s []string
+	for f, msg := range m {
+		s = append(s, f.typ+"."+f.fun+"="+msg)
+	}
+	sort.Strings(s)
+	return strings.Join(s, ",")
+}
+
+func (m rootMessageFlag) Set(flag string) error {
+	root, msg, ok := strings.Cut(flag, "=")
+	if !ok || msg == "" {
+		return fmt.Errorf("malformed root message: %s", flag)
+	}
+	f, _, err := parseRoot(root)
+	if err != nil {
+		return err
+	}
+	m[f] = msg
+	return nil
+}
+
+// findingTitle returns the title of the comment on hunk: the -root-message of
+// each root reaching it, or the title of the comments for the roots without
+// one. The messages of several roots are listed with their roots.
+func findingTitle(hunk *Hunk) string {
+	title := text().Title
+	if len(rootMessages) == 0 {
+		return title
+	}
+	var roots, titles []string
+	for _, root := range hunk.roots {
+		msg, ok := rootMessages[rootFunctionOf(root)]
+		if !ok {
+			msg = title
+		}
+		if !slices.Contains(titles, msg) {
+			roots = append(roots, root.FullName())
+			titles = append(titles, msg)
+		}
+	}
+	switch len(titles) {
+	case 0:
+		return title
+	case 1:
+		return titles[0]
+	}
+	var b strings.Builder
+	for i, msg := range titles {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "- %s (`%s`)", msg, roots[i])
+	}
+	return b.String()
 }
 
 type reviewComment struct {
-	CommitID  string `json:"commit_id"`
-	StartLine int    `json:"start_line"`
+	ID        int64  `json:"id,omitempty"`
+	CommitID  string `json:"commit_id,omitempty"`
+	StartLine int    `json:"start_line,omitempty"`
 	Line      int    `json:"line"`
 	Path      string `json:"path"`
 	Body      string `json:"body"`
 }
 
+// pullReview is a review comprising several review comments.
+type pullReview struct {
+	CommitID string          `json:"commit_id"`
+	Body     string          `json:"body"`
+	Event    string          `json:"event"`
+	Comments []reviewComment `json:"comments"`
+}
+
 type commentKey struct {
 	Path string
 	Line int
 }
 
+// postedComments describes the review comments posted by earlier runs.
+type postedComments struct {
+	// lines are the positions of comments without fingerprints.
+	lines map[commentKey]bool
+	// fingerprints maps the fingerprints of the commented findings to their
+	// comments.
+	fingerprints map[string]reviewComment
+}
+
 func postReviewComment(ctx context.Context, gh *github.Client, owner, repo string, comment *reviewComment) error {
-	url := fmt.Sprintf("%srepos/%s/%s/pulls/%d/comments", gh.BaseURL, owner, repo, *prnum)
+	url := apiEndpoint(gh, "repos/%s/%s/pulls/%d/comments", owner, repo, *prnum)
 	body, err := json.Marshal(comment)
 	if err != nil {
 		return err
@@ -149,6 +1144,40 @@ func postReviewComment(ctx context.Context, gh *github.Client, owner, repo strin
 	return err
 }
 
+// updateReviewComment replaces the body of the review comment with the given
+// id.
+func updateReviewComment(ctx context.Context, gh *github.Client, owner, repo string, id int64, body string) error {
+	url := apiEndpoint(gh, "repos/%s/%s/pulls/comments/%d", owner, repo, id)
+	data, err := json.Marshal(struct {
+		Body string `json:"body"`
+	}{body})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "PATCH", url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	_, err = gh.Do(ctx, req, nil)
+	return err
+}
+
+func postReview(ctx context.Context, gh *github.Client, owner, repo string, review *pullReview) error {
+	url := apiEndpoint(gh, "repos/%s/%s/pulls/%d/reviews", owner, repo, *prnum)
+	body, err := json.Marshal(review)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	_, err = gh.Do(ctx, req, nil)
+	return err
+}
+
 func hasComment(ctx context.Context, gh *github.Client, owner, repo string) (bool, error) {
 	page := 0
 	for {
@@ -158,7 +1187,7 @@ func hasComment(ctx context.Context, gh *github.Client, owner, repo string) (boo
 			return false, err
 		}
 		for _, comment := range comments {
-			if strings.Contains(comment.GetBody(), commentTitle) {
+			if isOwnComment(comment.GetBody()) {
 				return true, nil
 			}
 		}
@@ -170,11 +1199,14 @@ func hasComment(ctx context.Context, gh *github.Client, owner, repo string) (boo
 	return false, nil
 }
 
-func getReviewComments(ctx context.Context, gh *github.Client, owner, repo string) (map[commentKey]bool, error) {
-	commentMap := make(map[commentKey]bool)
+func getReviewComments(ctx context.Context, gh *github.Client, owner, repo string) (*postedComments, error) {
+	posted := &postedComments{
+		lines:        make(map[commentKey]bool),
+		fingerprints: make(map[string]reviewComment),
+	}
 	page := 0
 	for {
-		url := fmt.Sprintf("%srepos/%s/%s/pulls/%d/comments?page=%d", gh.BaseURL, owner, repo, *prnum, page)
+		url := apiEndpoint(gh, "repos/%s/%s/pulls/%d/comments?page=%d", owner, repo, *prnum, page)
 		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 		if err != nil {
 			return nil, err
@@ -186,8 +1218,14 @@ func getReviewComments(ctx context.Context, gh *github.Client, owner, repo strin
 			return nil, err
 		}
 		for _, comment := range comments {
-			if strings.Contains(comment.Body, commentTitle) {
-				commentMap[commentKey{comment.Path, comment.Line}] = true
+			if !isOwnComment(comment.Body) {
+				continue
+			}
+			if fingerprint, ok := commentFingerprint(comment.Body); ok {
+				posted.fingerprints[fingerprint] = comment
+			} else {
+				// Comments from earlier versions lack fingerprints.
+				posted.lines[commentKey{comment.Path, comment.Line}] = true
 			}
 		}
 		if resp.NextPage == 0 {
@@ -195,35 +1233,134 @@ func getReviewComments(ctx context.Context, gh *github.Client, owner, repo strin
 		}
 		page = resp.NextPage
 	}
-	return commentMap, nil
+	return posted, nil
+}
+
+// sleep waits for d or until ctx is done.
+var sleep = func(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
+// getDiff waits for GitHub to compute the mergeability of the PR, backing off
+// as configured by the flags, and returns the PR and its diff. The waits are
+// extended to the reset time of an exhausted rate limit. There is no wait for
+// -history, because the mergeability of closed PRs is not computed.
 func getDiff(ctx context.Context, gh *github.Client, owner, repo string) (*github.PullRequest, *bytes.Buffer, error) {
-	dur := time.Second
+	delay := *mergeDelay
+	var waited time.Duration
 	retries := 0
 	for {
-		pr, _, err := gh.PullRequests.Get(ctx, owner, repo, *prnum)
-		if err != nil {
+		pr, resp, err := gh.PullRequests.Get(ctx, owner, repo, *prnum)
+		var rate *github.Rate
+		var rateErr *github.RateLimitError
+		switch {
+		case errors.As(err, &rateErr):
+			rate = &rateErr.Rate
+		case err != nil:
 			return nil, nil, err
+		case pr.Mergeable == nil && !*history:
+			if resp.Rate.Remaining == 0 {
+				rate = &resp.Rate
+			}
 		}
-		if pr.Mergeable == nil {
-			if retries > 5 {
-				return nil, nil, fmt.Errorf("gave up waiting for mergeable PR; tried %d times", retries)
+		if err != nil || pr.Mergeable == nil && !*history {
+			// The error of giving up names the rate limit holding up
+			// the last attempt.
+			cause := err
+			if cause == nil && rate != nil {
+				cause = fmt.Errorf("API rate limit exhausted until %v", rate.Reset.Time.Format(time.RFC3339))
 			}
+			if retries >= *mergeRetries {
+				return nil, nil, giveUpError(fmt.Sprintf("gave up waiting for mergeable PR; tried %d times", retries+1), cause)
+			}
+			wait := delay
+			if rate != nil {
+				if reset := time.Until(rate.Reset.Time); reset > wait {
+					wait = reset
+				}
+			}
+			if *mergeMaxWait > 0 && waited+wait > *mergeMaxWait {
+				return nil, nil, giveUpError(fmt.Sprintf("gave up waiting for mergeable PR after %v", waited), cause)
+			}
+			if err := sleep(ctx, wait); err != nil {
+				return nil, nil, err
+			}
+			waited += wait
 			retries++
-			time.Sleep(dur)
-			dur *= 2
+			delay = time.Duration(float64(delay) * *mergeFactor)
 			continue
 		}
-		req, err := http.NewRequestWithContext(ctx, "GET", pr.GetDiffURL(), nil)
+		if *mergeCommit {
+			// The test merge commit of the PR has the base as its first
+			// parent, so its diff from the base is the effect of merging.
+			if pr.GetMergeCommitSHA() == "" {
+				return nil, nil, fmt.Errorf("PR %d has no merge commit", *prnum)
+			}
+			patch, err := getCompareDiff(ctx, gh, owner, repo, pr.GetBase().GetSHA(), pr.GetMergeCommitSHA())
+			if err != nil {
+				return nil, nil, err
+			}
+			return pr, patch, nil
+		}
+		patch, err := downloadDiff(ctx, gh, pr.GetDiffURL())
 		if err != nil {
 			return nil, nil, err
 		}
+		return pr, patch, nil
+	}
+}
+
+// giveUpError returns the error msg of giving up, wrapping its cause if any.
+func giveUpError(msg string, cause error) error {
+	if cause == nil {
+		return errors.New(msg)
+	}
+	return fmt.Errorf("%s: %w", msg, cause)
+}
+
+// downloadDiff downloads the diff at diffURL. Server errors and failed requests
+// are retried -diff-retries times, with a delay starting at -diff-delay and
+// doubling after every attempt.
+func downloadDiff(ctx context.Context, gh *github.Client, diffURL string) (*bytes.Buffer, error) {
+	delay := *diffDelay
+	for retries := 0; ; retries++ {
+		req, err := http.NewRequestWithContext(ctx, "GET", diffURL, nil)
+		if err != nil {
+			return nil, err
+		}
 		req.Header.Set("Accept", "application/vnd.github.v3.diff")
 		patch := new(bytes.Buffer)
-		if _, err := gh.Do(ctx, req, patch); err != nil {
-			return nil, nil, err
+		_, err = gh.Do(ctx, req, patch)
+		if err == nil {
+			return patch, nil
 		}
-		return pr, patch, nil
+		if retries >= *diffRetries || !isTransient(err) || ctx.Err() != nil {
+			return nil, err
+		}
+		if *debug {
+			fmt.Fprintf(os.Stderr, "consensuswarn: retrying the diff download in %v: %v\n", delay, err)
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+		delay *= 2
+	}
+}
+
+// isTransient reports whether err is a server error or a failed request of
+// the GitHub API, which may succeed when repeated.
+func isTransient(err error) bool {
+	var errResp *github.ErrorResponse
+	if errors.As(err, &errResp) {
+		return errResp.Response != nil && errResp.Response.StatusCode >= http.StatusInternalServerError
 	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
 }
@@ -0,0 +1,1889 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/token"
+	"go/types"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// fakeGitHub is a fake GitHub API server for pull requests.
+type fakeGitHub struct {
+	*httptest.Server
+	// diffs maps the numbers of the pull requests to their diffs.
+	diffs map[string]string
+	// reviewComments is the JSON list of existing review comments.
+	reviewComments string
+	// issueComments is the JSON list of existing issue comments.
+	issueComments string
+	// readOnly rejects the comments as if the token lacks write
+	// permission.
+	readOnly bool
+	// compareDiff is the diff of the head commit from its parent.
+	compareDiff string
+	// mergeDiff is the diff of the merge commit from the base.
+	mergeDiff string
+	// pending is the number of times the mergeability of the PR is
+	// reported as not yet computed.
+	pending int
+	// diffFailures is the number of times the download of a diff fails
+	// with a server error.
+	diffFailures int
+	// rateReset, if set, is reported as the reset time of an exhausted
+	// rate limit while the mergeability is pending.
+	rateReset time.Time
+	// labels are the labels of the pull requests, updated by the
+	// labels API.
+	labels []string
+	// fork, if set, is the owner/repo of the fork holding the head of the
+	// pull requests.
+	fork string
+	// commitComments is the JSON list of existing comments on the head
+	// commit.
+	commitComments string
+
+	mu       sync.Mutex
+	requests []*http.Request
+	// bodies holds the body of each request.
+	bodies []string
+}
+
+func newFakeGitHub(t *testing.T, diff string) *fakeGitHub {
+	f := &fakeGitHub{diffs: map[string]string{"1": diff}, reviewComments: `[]`, issueComments: `[]`, commitComments: `[]`}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/owner/repo/pulls/{n}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		pending := f.pending > 0
+		if pending {
+			f.pending--
+		}
+		f.mu.Unlock()
+		if pending {
+			if !f.rateReset.IsZero() {
+				w.Header().Set("X-RateLimit-Remaining", "0")
+				w.Header().Set("X-RateLimit-Reset", fmt.Sprint(f.rateReset.Unix()))
+			}
+			fmt.Fprintf(w, `{"mergeable": null, "diff_url": %q, "head": {"sha": "abcdef"}}`, f.URL+"/diff/"+r.PathValue("n"))
+			return
+		}
+		f.mu.Lock()
+		var labels []string
+		for _, l := range f.labels {
+			labels = append(labels, fmt.Sprintf(`{"name": %q}`, l))
+		}
+		f.mu.Unlock()
+		headRepo := "owner/repo"
+		if f.fork != "" {
+			headRepo = f.fork
+		}
+		fmt.Fprintf(w, `{"mergeable": true, "diff_url": %q, "head": {"sha": "abcdef", "repo": {"full_name": %q}}, "base": {"sha": "fedcba", "repo": {"full_name": "owner/repo"}}, "merge_commit_sha": "987654", "labels": [%s]}`, f.URL+"/diff/"+r.PathValue("n"), headRepo, strings.Join(labels, ", "))
+	})
+	mux.HandleFunc("POST /repos/owner/repo/issues/{n}/labels", func(w http.ResponseWriter, r *http.Request) {
+		var add []string
+		if err := json.NewDecoder(r.Body).Decode(&add); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.labels = append(f.labels, add...)
+		f.mu.Unlock()
+		fmt.Fprint(w, `[]`)
+	})
+	mux.HandleFunc("DELETE /repos/owner/repo/issues/{n}/labels/{name}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for i, l := range f.labels {
+			if l == r.PathValue("name") {
+				f.labels = append(f.labels[:i], f.labels[i+1:]...)
+				fmt.Fprint(w, `[]`)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("GET /diff/{n}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		fail := f.diffFailures > 0
+		if fail {
+			f.diffFailures--
+		}
+		f.mu.Unlock()
+		if fail {
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+			return
+		}
+		fmt.Fprint(w, f.diffs[r.PathValue("n")])
+	})
+	mux.HandleFunc("GET /repos/owner/repo/commits/{sha}", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"sha": %q, "parents": [{"sha": "012345"}]}`, r.PathValue("sha"))
+	})
+	mux.HandleFunc("GET /repos/owner/repo/compare/{spec}", func(w http.ResponseWriter, r *http.Request) {
+		switch r.PathValue("spec") {
+		case "012345...abcdef":
+			fmt.Fprint(w, f.compareDiff)
+		case "fedcba...987654":
+			fmt.Fprint(w, f.mergeDiff)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	mux.HandleFunc("GET /repos/owner/repo/issues/{n}/comments", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, f.issueComments)
+	})
+	mux.HandleFunc("POST /repos/owner/repo/issues/{n}/comments", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc("GET /repos/owner/repo/pulls/{n}/comments", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, f.reviewComments)
+	})
+	mux.HandleFunc("POST /repos/owner/repo/pulls/{n}/comments", func(w http.ResponseWriter, r *http.Request) {
+		if f.readOnly {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message": "Resource not accessible by integration"}`)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc("PATCH /repos/owner/repo/pulls/comments/{id}", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc("POST /repos/owner/repo/pulls/{n}/reviews", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc("GET /repos/owner/repo/commits/{sha}/comments", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, f.commitComments)
+	})
+	mux.HandleFunc("POST /repos/owner/repo/commits/{sha}/comments", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc("PATCH /repos/owner/repo/comments/{id}", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc("POST /repos/owner/repo/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id": 7}`)
+	})
+	mux.HandleFunc("PATCH /repos/owner/repo/check-runs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"id": %s}`, r.PathValue("id"))
+	})
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		f.mu.Lock()
+		f.requests = append(f.requests, r)
+		f.bodies = append(f.bodies, string(body))
+		f.mu.Unlock()
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(f.Close)
+	setFlag(t, prnum, 1)
+	setFlag(t, &prNumbers, intSlice{1})
+	setFlag(t, repository, "owner/repo")
+	return f
+}
+
+// setFlag sets a flag value for the duration of the test.
+func setFlag[T any](t *testing.T, p *T, v T) {
+	prev := *p
+	*p = v
+	t.Cleanup(func() { *p = prev })
+}
+
+// setupRun configures the flags for running the check against the sample
+// data.
+func setupRun(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	setFlag(t, dir, cwd)
+	setFlag(t, &rootNames, stringSlice{
+		"github.com/orijtech/consensuswarn/testdata.RootFunc1",
+		"github.com/orijtech/consensuswarn/testdata.T.RootMethod1",
+	})
+}
+
+func readFile(t *testing.T, path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// client returns a client for the fake server.
+func (f *fakeGitHub) client(t *testing.T, userAgent string) *github.Client {
+	return f.clientWithHeader(t, userAgent, nil)
+}
+
+// clientWithHeader returns a client for the fake server that sets header on
+// every request.
+func (f *fakeGitHub) clientWithHeader(t *testing.T, userAgent string, header http.Header) *github.Client {
+	gh := newClient(context.Background(), "", userAgent, header)
+	u, err := url.Parse(f.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gh.BaseURL = u
+	return gh
+}
+
+func TestAPIURL(t *testing.T) {
+	for _, raw := range []string{"https://ghe.example.com/api/v3", "https://ghe.example.com/api/v3/", "https://ghe.example.com/api/v3//"} {
+		u, err := apiBaseURL(raw)
+		if err != nil {
+			t.Fatalf("%s: %v", raw, err)
+		}
+		if got, want := u.String(), "https://ghe.example.com/api/v3/"; got != want {
+			t.Errorf("%s: base URL %s, expected %s", raw, got, want)
+		}
+		gh := github.NewClient(nil)
+		// Set the base as is to test the endpoint independently.
+		if gh.BaseURL, err = url.Parse(raw); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := apiEndpoint(gh, "repos/%s/%s/pulls/%d/comments", "owner", "repo", 1), "https://ghe.example.com/api/v3/repos/owner/repo/pulls/1/comments"; got != want {
+			t.Errorf("%s: endpoint %s, expected %s", raw, got, want)
+		}
+	}
+	if _, err := apiBaseURL("api.github.com"); err == nil {
+		t.Errorf("relative API URL accepted")
+	}
+
+	// A base without a trailing slash reaches the fake server.
+	f := newFakeGitHub(t, readFile(t, "testdata/state1.patch"))
+	setupRun(t)
+	gh := f.client(t, "")
+	base, err := apiBaseURL(f.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gh.BaseURL = base
+	if code := run(context.Background(), gh); code != exitOK {
+		t.Fatalf("exit code %d, expected %d", code, exitOK)
+	}
+	posted := 0
+	for _, r := range f.requests {
+		if r.Method == "POST" && r.URL.Path == "/repos/owner/repo/pulls/1/comments" {
+			posted++
+		}
+	}
+	if posted != 2 {
+		t.Errorf("%d comments posted, expected 2", posted)
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	f := newFakeGitHub(t, "")
+	const ua = "consensuswarn/test"
+	gh := f.client(t, ua)
+	ctx := context.Background()
+	if _, _, err := getDiff(ctx, gh, "owner", "repo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hasComment(ctx, gh, "owner", "repo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := getReviewComments(ctx, gh, "owner", "repo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := postReviewComment(ctx, gh, "owner", "repo", &reviewComment{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.requests) != 5 {
+		t.Errorf("expected 5 requests, got %d", len(f.requests))
+	}
+	for _, r := range f.requests {
+		if got := r.Header.Get("User-Agent"); got != ua {
+			t.Errorf("%s %s: User-Agent %q, expected %q", r.Method, r.URL.Path, got, ua)
+		}
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	f := newFakeGitHub(t, readFile(t, "testdata/state1.patch"))
+	setupRun(t)
+	h := headerFlag{}
+	for _, spec := range []string{"X-Audit-Token=secret", "X-Audit-Tag=a=b", "X-Audit-Tag=c"} {
+		if err := h.Set(spec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := h.Set("malformed"); err == nil {
+		t.Error("malformed header accepted")
+	}
+	if code := run(context.Background(), f.clientWithHeader(t, "", http.Header(h))); code != exitOK {
+		t.Fatalf("exit code %d, expected %d", code, exitOK)
+	}
+	if len(f.requests) == 0 {
+		t.Fatal("no requests")
+	}
+	for _, r := range f.requests {
+		if got := r.Header.Get("X-Audit-Token"); got != "secret" {
+			t.Errorf("%s %s: X-Audit-Token %q, expected %q", r.Method, r.URL.Path, got, "secret")
+		}
+		if got, want := r.Header.Values("X-Audit-Tag"), []string{"a=b", "c"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s %s: X-Audit-Tag %q, expected %q", r.Method, r.URL.Path, got, want)
+		}
+	}
+}
+
+func TestVersion(t *testing.T) {
+	wellFormed := regexp.MustCompile(`^\S+ \(\S+; \S+\)$`)
+	if v := versionString(); !wellFormed.MatchString(v) {
+		t.Errorf("default version %q is not well-formed", v)
+	}
+	setFlag(t, &version, "v1.2.3")
+	setFlag(t, &commit, "0123456789abcdef")
+	setFlag(t, &date, "2024-05-01T12:00:00Z")
+	if got, want := versionString(), "v1.2.3 (0123456789abcdef; 2024-05-01T12:00:00Z)"; got != want {
+		t.Errorf("version %q, expected %q", got, want)
+	}
+}
+
+func TestNoComment(t *testing.T) {
+	f := newFakeGitHub(t, readFile(t, "testdata/state1.patch"))
+	setupRun(t)
+	setFlag(t, noComment, true)
+	// Not even the label is written to the PR.
+	setFlag(t, label, "consensus-affecting")
+	if code := run(context.Background(), f.client(t, "")); code != exitFindings {
+		t.Errorf("exit code %d, expected %d", code, exitFindings)
+	}
+	for _, r := range f.requests {
+		if r.Method != "GET" || r.URL.Path != "/repos/owner/repo/pulls/1" && r.URL.Path != "/diff/1" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}
+}
+
+func TestLocalOutputUnmarked(t *testing.T) {
+	setupRun(t)
+	// The hidden markers of posted comments are left out of the output.
+	for _, f := range []string{"text", "junit"} {
+		setFlag(t, format, f)
+		fset := new(token.FileSet)
+		res, err := runCheck(context.Background(), fset, *dir, strings.NewReader(readFile(t, "testdata/state1.patch")), rootNames, checkOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := new(bytes.Buffer)
+		printFindings(out, fset, res)
+		if len(res.hunks) == 0 || strings.Contains(out.String(), "consensuswarn:fingerprint") {
+			t.Errorf("%s output of %d findings contains markers:\n%s", f, len(res.hunks), out)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	setupRun(t)
+	if code := validateRoots(context.Background()); code != exitOK {
+		t.Errorf("exit code %d for valid roots, expected %d", code, exitOK)
+	}
+	setFlag(t, &rootNames, append(rootNames, "github.com/orijtech/consensuswarn/testdata.MissingFunc"))
+	if code := validateRoots(context.Background()); code != exitError {
+		t.Errorf("exit code %d for missing root, expected %d", code, exitError)
+	}
+}
+
+func TestDumpRoots(t *testing.T) {
+	setupRun(t)
+	out := new(bytes.Buffer)
+	if code := dumpResolvedRoots(context.Background(), out); code != exitOK {
+		t.Fatalf("exit code %d, expected %d", code, exitOK)
+	}
+	var roots []resolvedRoot
+	if err := json.Unmarshal(out.Bytes(), &roots); err != nil {
+		t.Fatal(err)
+	}
+	want := []resolvedRoot{
+		{Name: "(*github.com/orijtech/consensuswarn/testdata.T).RootMethod1", File: "testdata/state.go", Line: 43},
+		{Name: "github.com/orijtech/consensuswarn/testdata.RootFunc1", File: "testdata/state.go", Line: 3},
+	}
+	if !reflect.DeepEqual(roots, want) {
+		t.Errorf("resolved roots\n%v\nexpected\n%v", roots, want)
+	}
+}
+
+func TestListReachableFiles(t *testing.T) {
+	setupRun(t)
+	setFlag(t, &rootNames, append(rootNames, "github.com/orijtech/consensuswarn/testdata/hookslice.Manager.Root"))
+	out := new(bytes.Buffer)
+	if code := listReachableFiles(context.Background(), out); code != exitOK {
+		t.Fatalf("exit code %d, expected %d", code, exitOK)
+	}
+	if got, want := out.String(), "testdata/hookslice/hookslice.go\ntestdata/state.go\n"; got != want {
+		t.Errorf("reachable files\n%s\nexpected\n%s", got, want)
+	}
+
+	// The files reachable only from disabled roots are left out.
+	setFlag(t, &disabledRoots, stringSlice{"github.com/orijtech/consensuswarn/testdata/hookslice.Manager.Root"})
+	out.Reset()
+	if code := listReachableFiles(context.Background(), out); code != exitOK {
+		t.Fatalf("exit code %d, expected %d", code, exitOK)
+	}
+	if got, want := out.String(), "testdata/state.go\n"; got != want {
+		t.Errorf("reachable files with a disabled root\n%s\nexpected\n%s", got, want)
+	}
+}
+
+func TestSymlinkedDir(t *testing.T) {
+	f := newFakeGitHub(t, readFile(t, "testdata/state1.patch"))
+	setupRun(t)
+	setFlag(t, noComment, true)
+	real, err := filepath.EvalSymlinks(*dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(t.TempDir(), "module")
+	if err := os.Symlink(*dir, link); err != nil {
+		t.Skip(err)
+	}
+	if got := resolveDir(link); got != real {
+		t.Errorf("resolved %s to %s, expected %s", link, got, real)
+	}
+	setFlag(t, dir, resolveDir(link))
+	if code := run(context.Background(), f.client(t, "")); code != exitFindings {
+		t.Errorf("exit code %d in symlinked directory, expected %d", code, exitFindings)
+	}
+}
+
+func TestListChangedSymbols(t *testing.T) {
+	f := newFakeGitHub(t, readFile(t, "testdata/state1.patch"))
+	setupRun(t)
+	c := &checker{fset: new(token.FileSet), dir: *dir}
+	out := new(bytes.Buffer)
+	_, patch, err := getDiff(context.Background(), f.client(t, ""), "owner", "repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := printChangedSymbols(context.Background(), out, c, patch); code != exitOK {
+		t.Fatalf("exit code %d, expected %d", code, exitOK)
+	}
+	// The context of the StateMethod1 hunk touches RootMethod1, as for the
+	// findings.
+	want := `(*github.com/orijtech/consensuswarn/testdata.T).NonStateMethod1
+(*github.com/orijtech/consensuswarn/testdata.T).RootMethod1
+(*github.com/orijtech/consensuswarn/testdata.T).StateMethod1
+github.com/orijtech/consensuswarn/testdata.NonStateFunc1
+github.com/orijtech/consensuswarn/testdata.StateFunc1
+`
+	if out.String() != want {
+		t.Errorf("changed symbols\n%s\nexpected\n%s", out, want)
+	}
+
+	// The packages not imported by the roots are loaded too.
+	moduleDir := writeModule(t, map[string]string{
+		"keeper/keeper.go": "package keeper\n\nfunc Root() {}\n",
+		"other/other.go":   "package other\n\nfunc Set() {\n}\n",
+	})
+	const otherPatch = `diff --git a/other/other.go b/other/other.go
+--- a/other/other.go
++++ b/other/other.go
+@@ -3,2 +3,3 @@
+ func Set() {
++	println()
+ }
+`
+	setFlag(t, &rootNames, stringSlice{"example.com/m/keeper.Root"})
+	setFlag(t, listSymbols, true)
+	opts, err := checkOptionsFromFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = &checker{fset: new(token.FileSet), dir: moduleDir, opts: opts}
+	out.Reset()
+	if code := printChangedSymbols(context.Background(), out, c, strings.NewReader(otherPatch)); code != exitOK {
+		t.Fatalf("exit code %d, expected %d", code, exitOK)
+	}
+	if want := "example.com/m/other.Set\n"; out.String() != want {
+		t.Errorf("changed symbols\n%s\nexpected\n%s", out, want)
+	}
+}
+
+func TestCommentBodyOmitsFrames(t *testing.T) {
+	pkg := types.NewPackage("example.com/p", "p")
+	sig := types.NewSignatureType(nil, nil, nil, nil, nil, false)
+	fset := token.NewFileSet()
+	file := fset.AddFile("p.go", -1, 10)
+	hunk := &Hunk{relFile: "p.go"}
+	for i := 0; i < 10; i++ {
+		hunk.stack = append(hunk.stack, stackEntry{fun: types.NewFunc(token.NoPos, pkg, fmt.Sprintf("F%d", i), sig), pos: file.Pos(0)})
+	}
+	body := commentBody(fset, hunk, 5)
+	want := "```\n" +
+		"example.com/p.F9 (p.go:1)\n" +
+		"example.com/p.F8 (p.go:1)\n" +
+		"example.com/p.F7 (p.go:1)\n" +
+		"... (5 frames omitted) ...\n" +
+		"example.com/p.F1 (p.go:1)\n" +
+		"example.com/p.F0 (p.go:1)\n" +
+		"```\n"
+	if !strings.Contains(body, want) {
+		t.Errorf("comment body\n%s\nexpected call sequence\n%s", body, want)
+	}
+	if body := commentBody(fset, hunk, 0); strings.Contains(body, "omitted") {
+		t.Errorf("unlimited comment body omits frames:\n%s", body)
+	}
+}
+
+func TestReviewMode(t *testing.T) {
+	f := newFakeGitHub(t, readFile(t, "testdata/state1.patch"))
+	setupRun(t)
+	setFlag(t, commentMode, "review")
+	if code := run(context.Background(), f.client(t, "")); code != exitOK {
+		t.Fatalf("exit code %d, expected %d", code, exitOK)
+	}
+	var reviews []pullReview
+	for i, r := range f.requests {
+		if r.Method != "POST" {
+			continue
+		}
+		if r.URL.Path != "/repos/owner/repo/pulls/1/reviews" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			continue
+		}
+		var review pullReview
+		if err := json.Unmarshal([]byte(f.bodies[i]), &review); err != nil {
+			t.Fatal(err)
+		}
+		reviews = append(reviews, review)
+	}
+	if len(reviews) != 1 {
+		t.Fatalf("expected 1 review, got %d", len(reviews))
+	}
+	if r := reviews[0]; r.Event != "COMMENT" || len(r.Comments) != 2 {
+		t.Errorf("expected a COMMENT review with 2 comments, got %s with %d", r.Event, len(r.Comments))
+	}
+}
+
+func TestDedupShiftedFinding(t *testing.T) {
+	patch := readFile(t, "testdata/state1.patch")
+	f := newFakeGitHub(t, patch)
+	setupRun(t)
+	hunks := checkPatch(t, "testdata/state1.patch", rootNames...)
+	// A comment on the first finding, posted before unrelated changes
+	// shifted it.
+	existing, err := json.Marshal([]reviewComment{{
+		Path: hunks[0].relFile,
+		Line: hunks[0].endLine + 10,
+		Body: postedCommentBody(new(token.FileSet), &hunks[0], 0),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.reviewComments = string(existing)
+	if code := run(context.Background(), f.client(t, "")); code != exitOK {
+		t.Fatalf("exit code %d, expected %d", code, exitOK)
+	}
+	var posted []reviewComment
+	for i, r := range f.requests {
+		if r.Method == "POST" {
+			var c reviewComment
+			if err := json.Unmarshal([]byte(f.bodies[i]), &c); err != nil {
+				t.Fatal(err)
+			}
+			posted = append(posted, c)
+		}
+	}
+	if len(posted) != 1 || posted[0].StartLine != hunks[1].startLine {
+		t.Errorf("expected only the second finding to be posted, got %+v", posted)
+	}
+}
+
+func TestUpdateComment(t *testing.T) {
+	patch := readFile(t, "testdata/state1.patch")
+	f := newFakeGitHub(t, patch)
+	setupRun(t)
+	hunks := checkPatch(t, "testdata/state1.patch", rootNames...)
+	var existing []reviewComment
+	for i, hunk := range hunks {
+		// Comments posted when the call sequences were different.
+		hunk.stack = hunk.stack[len(hunk.stack)-1:]
+		existing = append(existing, reviewComment{
+			ID:   int64(100 + i),
+			Path: hunk.relFile,
+			Line: hunk.endLine,
+			Body: postedCommentBody(new(token.FileSet), &hunk, 0),
+		})
+	}
+	data, err := json.Marshal(existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.reviewComments = string(data)
+	if code := run(context.Background(), f.client(t, "")); code != exitOK {
+		t.Fatalf("exit code %d, expected %d", code, exitOK)
+	}
+	var updated []string
+	for i, r := range f.requests {
+		switch r.Method {
+		case "POST":
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		case "PATCH":
+			updated = append(updated, r.URL.Path)
+			if !strings.Contains(f.bodies[i], "RootFunc1") && !strings.Contains(f.bodies[i], "RootMethod1") {
+				t.Errorf("updated body lacks the call sequence: %s", f.bodies[i])
+			}
+		}
+	}
+	want := []string{"/repos/owner/repo/pulls/comments/100", "/repos/owner/repo/pulls/comments/101"}
+	if !reflect.DeepEqual(updated, want) {
+		t.Errorf("updated comments %v, expected %v", updated, want)
+	}
+}
+
+func TestLocalizedComments(t *testing.T) {
+	f := newFakeGitHub(t, readFile(t, "testdata/state1.patch"))
+	setupRun(t)
+	setFlag(t, lang, "de")
+	if code := run(context.Background(), f.client(t, "")); code != exitOK {
+		t.Fatalf("exit code %d, expected %d", code, exitOK)
+	}
+	var posted []reviewComment
+	for i, r := range f.requests {
+		if r.Method != "POST" {
+			continue
+		}
+		var c reviewComment
+		if err := json.Unmarshal([]byte(f.bodies[i]), &c); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(c.Body, languages["de"].Title+"\n\n"+languages["de"].CallSequence) {
+			t.Errorf("comment is not in German:\n%s", c.Body)
+		}
+		c.ID = int64(100 + len(posted))
+		posted = append(posted, c)
+	}
+	if len(posted) != 2 {
+		t.Fatalf("%d comments posted, expected 2", len(posted))
+	}
+
+	// The German comments are recognized when checking in English.
+	data, err := json.Marshal(posted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f = newFakeGitHub(t, readFile(t, "testdata/state1.patch"))
+	f.reviewComments = string(data)
+	setFlag(t, lang, "en")
+	if code := run(context.Background(), f.client(t, "")); code != exitOK {
+		t.Fatalf("exit code %d, expected %d", code, exitOK)
+	}
+	for _, r := range f.requests {
+		if r.Method == "POST" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}
+
+	// So is a German summary table.
+	hunks := checkPatch(t, "testdata/state1.patch", rootNames...)
+	setFlag(t, lang, "de")
+	data, err = json.Marshal([]github.IssueComment{{Body: github.String(summaryTable(new(token.FileSet), hunks))}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f = newFakeGitHub(t, readFile(t, "testdata/state1.patch"))
+	f.issueComments = string(data)
+	setFlag(t, lang, "en")
+	setFlag(t, commentMode, "table")
+	if code := run(context.Background(), f.client(t, "")); code != exitOK {
+		t.Fatalf("exit code %d, expected %d", code, exitOK)
+	}
+	for _, r := range f.requests {
+		if r.Method == "POST" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}
+}
+
+func TestEditedTitle(t *testing.T) {
+	setupRun(t)
+	hunks := checkPatch(t, "testdata/state1.patch", rootNames...)
+	// Comments whose visible title was edited after they were posted.
+	var existing []reviewComment
+	for i, hunk := range hunks {
+		body := postedCommentBody(new(token.FileSet), &hunk, 0)
+		existing = append(existing, reviewComment{
+			ID:   int64(100 + i),
+			Path: hunk.relFile,
+			Line: hunk.endLine,
+			Body: strings.Replace(body, commentTitle, "Edited title.", 1),
+		})
+	}
+	data, err := json.Marshal(existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	posts := func(f *fakeGitHub) []string {
+		var bodies []string
+		for i, r := range f.requests {
+			if r.Method == "POST" {
+				bodies = append(bodies, f.bodies[i])
+			}
+		}
+		return bodies
+	}
+	f := newFakeGitHub(t, readFile(t, "testdata/state1.patch"))
+	f.reviewComments = string(data)
+	if code := run(context.Background(), f.client(t, "")); code != exitOK {
+		t.Fatalf("exit code %d, expected %d", code, exitOK)
+	}
+	if bodies := posts(f); len(bodies) != 0 {
+		t.Errorf("the comments with edited titles were posted again:\n%s", strings.Join(bodies, "\n"))
+	}
+
+	// So is a summary table with an edited title.
+	table := strings.Replace(summaryTable(new(token.FileSet), hunks), commentTitle, "Edited title.", 1)
+	data, err = json.Marshal([]github.IssueComment{{Body: github.String(table)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f = newFakeGitHub(t, readFile(t, "testdata/state1.patch"))
+	f.issueComments = string(data)
+	setFlag(t, commentMode, "table")
+	if code := run(context.Background(), f.client(t, "")); code != exitOK {
+		t.Fatalf("exit code %d, expected %d", code, exitOK)
+	}
+	if bodies := posts(f); len(bodies) != 0 {
+		t.Errorf("the table with an edited title was posted again:\n%s", strings.Join(bodies, "\n"))
+	}
+}
+
+func TestTableMode(t *testing.T) {
+	f := newFakeGitHub(t, readFile(t, "testdata/state1.patch"))
+	setupRun(t)
+	setFlag(t, commentMode, "table")
+	if code := run(context.Background(), f.client(t, "")); code != exitOK {
+		t.Fatalf("exit code %d, expected %d", code, exitOK)
+	}
+	var bodies []string
+	for i, r := range f.requests {
+		if r.Method != "POST" {
+			continue
+		}
+		if r.URL.Path != "/repos/owner/repo/issues/1/comments" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			continue
+		}
+		var c github.IssueComment
+		if err := json.Unmarshal([]byte(f.bodies[i]), &c); err != nil {
+			t.Fatal(err)
+		}
+		bodies = append(bodies, c.GetBody())
+	}
+	if len(bodies) != 1 {
+		t.Fatalf("expected 1 comment, got %d", len(bodies))
+	}
+	lines := strings.Split(strings.TrimSpace(bodies[0]), "\n")
+	want := []string{
+		commentTitle,
+		"",
+		"| File | Findings | Roots |",
+		"| --- | --- | --- |",
+		"| `testdata/state.go` | 2 | `(*github.com/orijtech/consensuswarn/testdata.T).RootMethod1`, `github.com/orijtech/consensuswarn/testdata.RootFunc1` |",
+		"",
+		"| File | Line | Root | Depth | Call sequence |",
+		"| --- | --- | --- | --- | --- |",
+	}
+	if len(lines) != len(want)+4 || !reflect.DeepEqual(lines[:len(want)], want) {
+		t.Fatalf("expected a table of 2 findings, got\n%s", bodies[0])
+	}
+	if marker := lines[len(lines)-1]; marker != commentMarker {
+		t.Errorf("table ends in %q, expected the marker %q", marker, commentMarker)
+	}
+	for _, row := range lines[len(want) : len(want)+2] {
+		if !strings.HasPrefix(row, "| `testdata/state.go` |") || !strings.Contains(row, "<details><summary>") || !strings.HasSuffix(row, "</details> |") {
+			t.Errorf("malformed row %q", row)
+		}
+	}
+}
+
+func TestSummaryRollup(t *testing.T) {
+	pkg := types.NewPackage("example.com/keeper", "keeper")
+	sig := types.NewSignatureType(nil, nil, nil, nil, nil, false)
+	root1 := stackEntry{fun: types.NewFunc(token.NoPos, pkg, "Root1", sig)}
+	root2 := stackEntry{fun: types.NewFunc(token.NoPos, pkg, "Root2", sig)}
+	touched := stackEntry{fun: types.NewFunc(token.NoPos, pkg, "mutate", sig)}
+	hunks := []Hunk{
+		{relFile: "a.go", startLine: 1, stack: []stackEntry{root2, touched}},
+		{relFile: "a.go", startLine: 10, stack: []stackEntry{root1, touched}},
+		{relFile: "a.go", startLine: 20, stack: []stackEntry{root2}},
+		{relFile: "b.go", startLine: 5, stack: []stackEntry{root1}},
+	}
+	table := summaryTable(new(token.FileSet), hunks)
+	want := "| File | Findings | Roots |\n" +
+		"| --- | --- | --- |\n" +
+		"| `a.go` | 3 | `example.com/keeper.Root1`, `example.com/keeper.Root2` |\n" +
+		"| `b.go` | 1 | `example.com/keeper.Root1` |\n" +
+		"\n| File | Line |"
+	if !strings.Contains(table, want) {
+		t.Errorf("table\n%s\nlacks the roll-up\n%s", table, want)
+	}
+}
+
+func TestFrameFiles(t *testing.T) {
+	setFlag(t, dir, "/src")
+	fset := token.NewFileSet()
+	rootFile := fset.AddFile("/src/app/app.go", -1, 10)
+	keeperFile := fset.AddFile("/src/x/keeper/keeper.go", -1, 10)
+	sig := types.NewSignatureType(nil, nil, nil, nil, nil, false)
+	root := stackEntry{fun: types.NewFunc(token.NoPos, types.NewPackage("example.com/app", "app"), "Root", sig), pos: rootFile.Pos(0)}
+	touched := stackEntry{fun: types.NewFunc(token.NoPos, types.NewPackage("example.com/x/keeper", "keeper"), "set", sig), pos: keeperFile.Pos(0)}
+	hunk := Hunk{relFile: "x/keeper/keeper.go", startLine: 1, stack: []stackEntry{root, touched}}
+	// The frames are labeled with their own files, not the file of the
+	// hunk.
+	for name, body := range map[string]string{
+		"comment": commentBody(fset, &hunk, 0),
+		"table":   summaryTable(fset, []Hunk{hunk}),
+	} {
+		for _, want := range []string{"Root</code> (app/app.go:1)", "set</code> (x/keeper/keeper.go:1)"} {
+			if name == "comment" {
+				want = strings.Replace(want, "</code>", "", 1)
+			}
+			if !strings.Contains(body, want) {
+				t.Errorf("%s\n%s\nlacks the frame %q", name, body, want)
+			}
+		}
+	}
+}
+
+// recordSleeps replaces sleep for the duration of the test and returns the
+// slept durations.
+func recordSleeps(t *testing.T) *[]time.Duration {
+	var slept []time.Duration
+	setFlag(t, &sleep, func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	})
+	return &slept
+}
+
+func TestMergeableBackoff(t *testing.T) {
+	f := newFakeGitHub(t, "")
+	f.pending = 3
+	slept := recordSleeps(t)
+	setFlag(t, mergeDelay, 10*time.Millisecond)
+	setFlag(t, mergeFactor, 3)
+	setFlag(t, mergeRetries, 3)
+	pr, _, err := getDiff(context.Background(), f.client(t, ""), "owner", "repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pr.GetMergeable() {
+		t.Error("expected a mergeable PR")
+	}
+	want := []time.Duration{10 * time.Millisecond, 30 * time.Millisecond, 90 * time.Millisecond}
+	if !reflect.DeepEqual(*slept, want) {
+		t.Errorf("slept %v, expected %v", *slept, want)
+	}
+
+	f.pending = 4
+	if _, _, err := getDiff(context.Background(), f.client(t, ""), "owner", "repo"); err == nil {
+		t.Error("expected to give up after 3 retries")
+	}
+	f.pending = 3
+	setFlag(t, mergeMaxWait, 50*time.Millisecond)
+	if _, _, err := getDiff(context.Background(), f.client(t, ""), "owner", "repo"); err == nil {
+		t.Error("expected to give up after the maximum wait")
+	}
+}
+
+func TestDiffRetry(t *testing.T) {
+	patch := readFile(t, "testdata/state1.patch")
+	f := newFakeGitHub(t, patch)
+	f.diffFailures = 2
+	slept := recordSleeps(t)
+	setFlag(t, diffDelay, 10*time.Millisecond)
+	setFlag(t, diffRetries, 3)
+	_, got, err := getDiff(context.Background(), f.client(t, ""), "owner", "repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != patch {
+		t.Errorf("downloaded diff\n%s\nexpected\n%s", got, patch)
+	}
+	if want := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond}; !reflect.DeepEqual(*slept, want) {
+		t.Errorf("slept %v, expected %v", *slept, want)
+	}
+
+	f.diffFailures = 2
+	setFlag(t, diffRetries, 1)
+	if _, _, err := getDiff(context.Background(), f.client(t, ""), "owner", "repo"); err == nil {
+		t.Error("expected to give up after 1 retry")
+	}
+}
+
+func TestMergeableRateLimit(t *testing.T) {
+	f := newFakeGitHub(t, "")
+	f.pending = 1
+	// The client refuses requests until the reset, so really wait.
+	f.rateReset = time.Now().Add(1500 * time.Millisecond).Truncate(time.Second)
+	var slept []time.Duration
+	setFlag(t, &sleep, func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		time.Sleep(d)
+		return nil
+	})
+	setFlag(t, mergeDelay, time.Millisecond)
+	if _, _, err := getDiff(context.Background(), f.client(t, ""), "owner", "repo"); err != nil {
+		t.Fatal(err)
+	}
+	if len(slept) == 0 || slept[0] <= time.Millisecond {
+		t.Errorf("slept %v, expected to wait for the rate limit reset", slept)
+	}
+
+	// Giving up while the client refuses requests reports the rate limit.
+	f = newFakeGitHub(t, "")
+	f.pending = 1
+	f.rateReset = time.Now().Add(time.Hour).Truncate(time.Second)
+	setFlag(t, &sleep, func(ctx context.Context, d time.Duration) error { return nil })
+	setFlag(t, mergeRetries, 1)
+	_, _, err := getDiff(context.Background(), f.client(t, ""), "owner", "repo")
+	var rateErr *github.RateLimitError
+	if !errors.As(err, &rateErr) || !strings.Contains(err.Error(), "rate reset in") {
+		t.Errorf("expected the error to wrap the rate limit error, got %v", err)
+	}
+}
+
+func TestMultiplePRs(t *testing.T) {
+	f := newFakeGitHub(t, readFile(t, "testdata/state1.patch"))
+	f.diffs["2"] = readFile(t, "testdata/embediface.patch")
+	setupRun(t)
+	setFlag(t, &prNumbers, intSlice{1, 2})
+	setFlag(t, &rootNames, append(rootNames, "github.com/orijtech/consensuswarn/testdata/embediface.Root"))
+	loads := 0
+	setFlag(t, &loadProgram, func(ctx context.Context, fset *token.FileSet, dir string, roots []string, opts checkOptions) (*program, error) {
+		loads++
+		return load(ctx, fset, dir, roots, opts)
+	})
+	if code := run(context.Background(), f.client(t, "")); code != exitOK {
+		t.Fatalf("exit code %d, expected %d", code, exitOK)
+	}
+	if loads != 1 {
+		t.Errorf("packages loaded %d times, expected once", loads)
+	}
+	posted := make(map[string][]string)
+	for i, r := range f.requests {
+		if r.Method != "POST" {
+			continue
+		}
+		var c reviewComment
+		if err := json.Unmarshal([]byte(f.bodies[i]), &c); err != nil {
+			t.Fatal(err)
+		}
+		posted[r.URL.Path] = append(posted[r.URL.Path], c.Path)
+	}
+	want := map[string][]string{
+		"/repos/owner/repo/pulls/1/comments": {"testdata/state.go", "testdata/state.go"},
+		"/repos/owner/repo/pulls/2/comments": {"testdata/embediface/embediface.go"},
+	}
+	if !reflect.DeepEqual(posted, want) {
+		t.Errorf("posted comments %v, expected %v", posted, want)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	f := newFakeGitHub(t, readFile(t, "testdata/state1.patch"))
+	f.diffs["2"] = readFile(t, "testdata/embediface.patch")
+	// The mergeability of closed PRs is not computed.
+	f.pending = 10
+	setupRun(t)
+	setFlag(t, history, true)
+	setFlag(t, &prNumbers, intSlice{1, 2})
+	out := new(bytes.Buffer)
+	c := &checker{fset: new(token.FileSet), dir: *dir}
+	if code := runHistory(context.Background(), f.client(t, ""), c, out); code != exitOK {
+		t.Fatalf("exit code %d, expected %d", code, exitOK)
+	}
+	want := `PR 1: 2 findings
+	testdata/state.go:14: reachable from github.com/orijtech/consensuswarn/testdata.RootFunc1
+	testdata/state.go:44: reachable from (*github.com/orijtech/consensuswarn/testdata.T).RootMethod1
+PR 2: no findings
+
+1 of 2 PRs would have been flagged
+1 findings reachable from (*github.com/orijtech/consensuswarn/testdata.T).RootMethod1
+1 findings reachable from github.com/orijtech/consensuswarn/testdata.RootFunc1
+`
+	if out.String() != want {
+		t.Errorf("report\n%s\nexpected\n%s", out, want)
+	}
+	for _, r := range f.requests {
+		if r.Method != "GET" || strings.HasSuffix(r.URL.Path, "/comments") {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}
+}
+
+func TestLatestCommitOnly(t *testing.T) {
+	f := newFakeGitHub(t, readFile(t, "testdata/state1.patch"))
+	f.compareDiff = readFile(t, "testdata/latest.patch")
+	setupRun(t)
+	setFlag(t, latestOnly, true)
+	if code := run(context.Background(), f.client(t, "")); code != exitOK {
+		t.Fatalf("exit code %d, expected %d", code, exitOK)
+	}
+	var posted []string
+	for i, r := range f.requests {
+		if r.Method != "POST" {
+			continue
+		}
+		var c reviewComment
+		if err := json.Unmarshal([]byte(f.bodies[i]), &c); err != nil {
+			t.Fatal(err)
+		}
+		posted = append(posted, c.Body)
+	}
+	// The hunk of the head commit is reached from RootMethod1.
+	if len(posted) != 1 || !strings.Contains(posted[0], "RootMethod1") {
+		t.Errorf("expected a single comment reached from RootMethod1, got %q", posted)
+	}
+
+	// The hunks are matched by their lines at the head, not by the text of
+	// their changes.
+	latest, err := parseLatestChanges([]byte(`diff --git a/testdata/state.go b/testdata/state.go
+--- a/testdata/state.go
++++ b/testdata/state.go
+@@ -48,1 +48,1 @@ func (t *T) StateMethod1() {
+-	println("state method")
++	println("state function change")
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hunks := checkPatch(t, "testdata/state1.patch", rootNames...)
+	var lines []int
+	for _, h := range latest.filter(hunks) {
+		lines = append(lines, h.startLine)
+	}
+	if want := []int{44}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("hunks at lines %v, expected %v", lines, want)
+	}
+}
+
+func TestMergeCommit(t *testing.T) {
+	// The PR diff touches nothing, but merging it does.
+	f := newFakeGitHub(t, "")
+	f.mergeDiff = readFile(t, "testdata/state1.patch")
+	setupRun(t)
+	setFlag(t, mergeCommit, true)
+	if code := run(context.Background(), f.client(t, "")); code != exitOK {
+		t.Fatalf("exit code %d, expected %d", code, exitOK)
+	}
+	var compared, posted int
+	for _, r := range f.requests {
+		switch {
+		case r.URL.Path == "/diff/1":
+			t.Errorf("unexpected request of the PR diff")
+		case r.URL.Path == "/repos/owner/repo/compare/fedcba...987654":
+			compared++
+		case r.Method == "POST":
+			posted++
+		}
+	}
+	if compared != 1 {
+		t.Errorf("%d requests of the merge commit diff, expected 1", compared)
+	}
+	if posted != 2 {
+		t.Errorf("%d comments posted, expected 2", posted)
+	}
+}
+
+func TestLabel(t *testing.T) {
+	f := newFakeGitHub(t, readFile(t, "testdata/state1.patch"))
+	setupRun(t)
+	setFlag(t, label, "consensus-affecting")
+	labelRequests := func() (n int) {
+		for _, r := range f.requests {
+			if strings.Contains(r.URL.Path, "/labels") {
+				n++
+			}
+		}
+		return n
+	}
+	runs := []struct {
+		diff   string
+		labels []string
+		// requests is the total number of label requests after the run.
+		requests int
+	}{
+		{readFile(t, "testdata/state1.patch"), []string{"consensus-affecting"}, 1},
+		// Labeling again is a no-op.
+		{readFile(t, "testdata/state1.patch"), []string{"consensus-affecting"}, 1},
+		{"", []string{}, 2},
+		{"", []string{}, 2},
+	}
+	for i, r := range runs {
+		f.diffs["1"] = r.diff
+		if code := run(context.Background(), f.client(t, "")); code != exitOK {
+			t.Fatalf("run %d: exit code %d, expected %d", i, code, exitOK)
+		}
+		if !reflect.DeepEqual(f.labels, r.labels) {
+			t.Errorf("run %d: labels %q, expected %q", i, f.labels, r.labels)
+		}
+		if n := labelRequests(); n != r.requests {
+			t.Errorf("run %d: %d label requests, expected %d", i, n, r.requests)
+		}
+	}
+}
+
+func TestForkPR(t *testing.T) {
+	f := newFakeGitHub(t, readFile(t, "testdata/state1.patch"))
+	f.fork = "contributor/fork"
+	f.compareDiff = readFile(t, "testdata/state1.patch")
+	setupRun(t)
+	setFlag(t, latestOnly, true)
+	if code := run(context.Background(), f.client(t, "")); code != exitOK {
+		t.Fatalf("exit code %d, expected %d", code, exitOK)
+	}
+	posted := 0
+	for i, r := range f.requests {
+		if r.URL.Path != "/diff/1" && !strings.HasPrefix(r.URL.Path, "/repos/owner/repo/") {
+			t.Errorf("request %s %s outside the base repository", r.Method, r.URL.Path)
+		}
+		if r.Method != "POST" {
+			continue
+		}
+		posted++
+		var c reviewComment
+		if err := json.Unmarshal([]byte(f.bodies[i]), &c); err != nil {
+			t.Fatal(err)
+		}
+		if c.CommitID != "abcdef" {
+			t.Errorf("comment on commit %q, expected the head commit abcdef", c.CommitID)
+		}
+	}
+	if posted != 2 {
+		t.Errorf("%d comments posted, expected 2", posted)
+	}
+}
+
+func TestToolchain(t *testing.T) {
+	setFlag(t, &loadVars, envFlag{"GOTOOLCHAIN=local", "GOFLAGS=-mod=mod"})
+	setFlag(t, toolchain, "bogus")
+	opts, err := checkOptionsFromFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"GOTOOLCHAIN=local", "GOFLAGS=-mod=mod", "GOTOOLCHAIN=bogus"}; !reflect.DeepEqual(opts.env, want) {
+		t.Errorf("load environment %q, expected %q", opts.env, want)
+	}
+	if !reflect.DeepEqual(loadVars, envFlag{"GOTOOLCHAIN=local", "GOFLAGS=-mod=mod"}) {
+		t.Errorf("-env modified to %q", loadVars)
+	}
+	// The go command rejects the toolchain.
+	moduleDir := writeModule(t, map[string]string{"keeper/keeper.go": "package keeper\n\nfunc Set() {}\n"})
+	_, err = load(context.Background(), new(token.FileSet), moduleDir, []string{"example.com/m/keeper.Set"}, opts)
+	if err == nil || !strings.Contains(err.Error(), "bogus") {
+		t.Errorf("expected the load to fail with the bogus toolchain, got %v", err)
+	}
+	// So do -validate and -dump-roots.
+	setFlag(t, dir, moduleDir)
+	setFlag(t, &rootNames, stringSlice{"example.com/m/keeper.Set"})
+	if code := validateRoots(context.Background()); code != exitError {
+		t.Errorf("-validate exit code %d with the bogus toolchain, expected %d", code, exitError)
+	}
+	if code := dumpResolvedRoots(context.Background(), io.Discard); code != exitError {
+		t.Errorf("-dump-roots exit code %d with the bogus toolchain, expected %d", code, exitError)
+	}
+}
+
+func TestMergedHunksComment(t *testing.T) {
+	f := newFakeGitHub(t, readFile(t, "testdata/samefunc.patch"))
+	setupRun(t)
+	setFlag(t, &rootNames, stringSlice{"github.com/orijtech/consensuswarn/testdata/samefunc.Root"})
+	if code := run(context.Background(), f.client(t, "")); code != exitOK {
+		t.Fatalf("exit code %d, expected %d", code, exitOK)
+	}
+	var comments []map[string]any
+	for i, r := range f.requests {
+		if r.Method != "POST" {
+			continue
+		}
+		var c map[string]any
+		if err := json.Unmarshal([]byte(f.bodies[i]), &c); err != nil {
+			t.Fatal(err)
+		}
+		comments = append(comments, c)
+	}
+	if len(comments) != 1 {
+		t.Fatalf("%d comments posted for 2 hunks in a function, expected 1", len(comments))
+	}
+	// The comment spans the lines of the second hunk only.
+	if start, line := comments[0]["start_line"], comments[0]["line"]; start != 24.0 || line != 29.0 {
+		t.Errorf("comment at lines %v-%v, expected 24-29", start, line)
+	}
+
+	// The comment on the pushed commit is anchored in the second hunk
+	// too, at the last line of the diff.
+	f = newFakeGitHub(t, "")
+	f.compareDiff = readFile(t, "testdata/samefunc.patch")
+	setFlag(t, &prNumbers, nil)
+	setFlag(t, pushCommit, "abcdef")
+	if code := run(context.Background(), f.client(t, "")); code != exitOK {
+		t.Fatalf("exit code %d, expected %d", code, exitOK)
+	}
+	var positions []int
+	for i, r := range f.requests {
+		if r.Method != "POST" {
+			continue
+		}
+		var c github.RepositoryComment
+		if err := json.Unmarshal([]byte(f.bodies[i]), &c); err != nil {
+			t.Fatal(err)
+		}
+		positions = append(positions, c.GetPosition())
+	}
+	if want := []int{15}; !reflect.DeepEqual(positions, want) {
+		t.Errorf("commit comments at positions %v, expected %v", positions, want)
+	}
+}
+
+func TestCommentOncePerFunction(t *testing.T) {
+	// postComments runs the check of the 3 hunks in a function and returns
+	// the posted comments.
+	postComments := func(once bool) []map[string]any {
+		f := newFakeGitHub(t, readFile(t, "testdata/oncefunc.patch"))
+		setupRun(t)
+		setFlag(t, &rootNames, stringSlice{"github.com/orijtech/consensuswarn/testdata/oncefunc.Root"})
+		setFlag(t, oncePerFunc, once)
+		if code := run(context.Background(), f.client(t, "")); code != exitOK {
+			t.Fatalf("exit code %d, expected %d", code, exitOK)
+		}
+		var comments []map[string]any
+		for i, r := range f.requests {
+			if r.Method != "POST" {
+				continue
+			}
+			var c map[string]any
+			if err := json.Unmarshal([]byte(f.bodies[i]), &c); err != nil {
+				t.Fatal(err)
+			}
+			comments = append(comments, c)
+		}
+		// The findings of a function are merged with or without the
+		// flag.
+		if len(comments) != 1 {
+			t.Fatalf("%d comments posted for 3 hunks in a function, expected 1", len(comments))
+		}
+		return comments
+	}
+	// Without the flag, the comment spans the last hunk.
+	comments := postComments(false)
+	if start, line := comments[0]["start_line"], comments[0]["line"]; start != float64(34) || line != float64(39) {
+		t.Errorf("comment at lines %v-%v, expected 34-39", start, line)
+	}
+	// With the flag, it is anchored at the first changed line alone.
+	comments = postComments(true)
+	if line, ok := comments[0]["line"].(float64); !ok || line != 17 {
+		t.Errorf("comment at line %v, expected 17", comments[0]["line"])
+	}
+	if start, ok := comments[0]["start_line"]; ok {
+		t.Errorf("comment starts at line %v, expected a single line", start)
+	}
+}
+
+func TestFailThreshold(t *testing.T) {
+	// The sample patch has 2 findings.
+	tests := []struct {
+		threshold int
+		noComment bool
+		want      int
+	}{
+		{-1, false, exitOK},
+		{-1, true, exitFindings},
+		{1, false, exitFindings},
+		{2, false, exitOK},
+		{3, false, exitOK},
+		{1, true, exitFindings},
+		{2, true, exitOK},
+	}
+	for _, test := range tests {
+		f := newFakeGitHub(t, readFile(t, "testdata/state1.patch"))
+		setupRun(t)
+		setFlag(t, failThreshold, test.threshold)
+		setFlag(t, noComment, test.noComment)
+		if code := run(context.Background(), f.client(t, "")); code != test.want {
+			t.Errorf("-fail-threshold %d, -no-comment %v: exit code %d, expected %d", test.threshold, test.noComment, code, test.want)
+		}
+		posted := 0
+		for _, r := range f.requests {
+			if r.Method == "POST" {
+				posted++
+			}
+		}
+		if want := 2; !test.noComment && posted != want {
+			t.Errorf("-fail-threshold %d: %d comments posted, expected %d", test.threshold, posted, want)
+		}
+	}
+}
+
+func TestDeterministicOutput(t *testing.T) {
+	// Root reaches touched through any of the functions assigned to k.f
+	// by different functions, the first of which must be the same in every
+	// run.
+	moduleDir := writeModule(t, map[string]string{"keeper/keeper.go": `package keeper
+
+var state int
+
+type K struct{ f func() }
+
+func Root(k *K) { k.f() }
+
+func SetA(k *K) { k.f = a }
+func SetB(k *K) { k.f = b }
+func SetC(k *K) { k.f = c }
+func SetD(k *K) { k.f = d }
+
+func a() { touched() }
+func b() { touched() }
+func c() { touched() }
+func d() { touched() }
+
+func touched() {
+	state = 1
+}
+`})
+	const patch = `diff --git a/keeper/keeper.go b/keeper/keeper.go
+--- a/keeper/keeper.go
++++ b/keeper/keeper.go
+@@ -19,3 +19,3 @@ func d() { touched() }
+ func touched() {
+-	state = 0
++	state = 1
+ }
+`
+	setFlag(t, dir, moduleDir)
+	for _, f := range []string{"text", "json", "junit", "dot"} {
+		setFlag(t, format, f)
+		var outputs []string
+		for i := 0; i < 10; i++ {
+			fset := new(token.FileSet)
+			res, err := runCheck(context.Background(), fset, moduleDir, strings.NewReader(patch), []string{"example.com/m/keeper.Root"}, checkOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res.hunks) != 1 {
+				t.Fatalf("expected 1 finding, got %d", len(res.hunks))
+			}
+			out := new(bytes.Buffer)
+			printFindings(out, fset, res)
+			outputs = append(outputs, out.String())
+		}
+		for _, out := range outputs[1:] {
+			if out != outputs[0] {
+				t.Fatalf("%s output differs between runs:\n%s\nand\n%s", f, outputs[0], out)
+			}
+		}
+	}
+}
+
+func TestProgress(t *testing.T) {
+	tests := []struct {
+		mode, format string
+		terminal     bool
+		want         bool
+	}{
+		{"auto", "text", true, true},
+		{"auto", "text", false, false},
+		{"auto", "junit", true, false},
+		{"on", "junit", false, true},
+		{"off", "text", true, false},
+	}
+	for _, test := range tests {
+		if got := showProgress(test.mode, test.format, test.terminal); got != test.want {
+			t.Errorf("showProgress(%q, %q, %v) = %v, expected %v", test.mode, test.format, test.terminal, got, test.want)
+		}
+	}
+
+	// A run over many packages reports its progress.
+	files := map[string]string{"root/root.go": "package root\n\nfunc Root() {}\n"}
+	var imports strings.Builder
+	for i := 0; i < progressInterval; i++ {
+		fmt.Fprintf(&imports, "\t_ \"example.com/m/p%d\"\n", i)
+		files[fmt.Sprintf("p%d/p.go", i)] = fmt.Sprintf("package p%d\n\nfunc F() {}\n", i)
+	}
+	files["root/root.go"] = "package root\n\nimport (\n" + imports.String() + ")\n\nfunc Root() {}\n"
+	dir := writeModule(t, files)
+	var messages []string
+	opts := checkOptions{progressf: func(format string, args ...any) {
+		messages = append(messages, fmt.Sprintf(format, args...))
+	}}
+	if _, err := runCheck(context.Background(), new(token.FileSet), dir, strings.NewReader(""), []string{"example.com/m/root.Root"}, opts); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"loading the packages of 1 roots",
+		fmt.Sprintf("loaded %d packages", progressInterval+1),
+		fmt.Sprintf("registered the functions of %d/%d packages", progressInterval, progressInterval+1),
+		fmt.Sprintf("registered %d functions", progressInterval+1),
+		"walked root 1/1: example.com/m/root.Root",
+	}
+	if !reflect.DeepEqual(messages, want) {
+		t.Errorf("progress messages\n%q\nexpected\n%q", messages, want)
+	}
+
+	// Loading the packages is not silent for long.
+	setFlag(t, &progressHeartbeat, time.Millisecond)
+	messages = nil
+	if _, err := runCheck(context.Background(), new(token.FileSet), dir, strings.NewReader(""), []string{"example.com/m/root.Root"}, opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) < 3 || messages[0] != want[0] || !strings.HasPrefix(messages[1], "still loading the packages for ") {
+		t.Errorf("progress messages\n%q\nexpected a heartbeat after %q", messages, want[0])
+	}
+}
+
+func TestReadOnlyToken(t *testing.T) {
+	f := newFakeGitHub(t, readFile(t, "testdata/state1.patch"))
+	f.readOnly = true
+	setupRun(t)
+	if code := run(context.Background(), f.client(t, "")); code != exitFindings {
+		t.Errorf("exit code %d, expected %d", code, exitFindings)
+	}
+	posts := 0
+	for _, r := range f.requests {
+		if r.Method == "POST" {
+			posts++
+		}
+	}
+	if posts != 1 {
+		t.Errorf("expected the first rejected comment to stop posting, got %d posts", posts)
+	}
+}
+
+func TestGOOS(t *testing.T) {
+	setupRun(t)
+	setFlag(t, &rootNames, stringSlice{"github.com/orijtech/consensuswarn/testdata/platform.Root"})
+	patch := readFile(t, "testdata/platform.patch")
+	// A single platform is loaded in place of the host.
+	setFlag(t, &goosList, stringSlice{"darwin"})
+	c := newChecker(*dir, checkOptions{})
+	res, err := c.findings(context.Background(), strings.NewReader(patch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.hunks) != 1 || !strings.HasSuffix(res.hunks[0].file, "root_darwin.go") {
+		t.Fatalf("expected the darwin hunk, got %v", res.hunks)
+	}
+	out := new(bytes.Buffer)
+	if code := dumpResolvedRoots(context.Background(), out); code != exitOK {
+		t.Fatalf("-dump-roots exit code %d", code)
+	}
+	var roots []resolvedRoot
+	if err := json.Unmarshal(out.Bytes(), &roots); err != nil {
+		t.Fatal(err)
+	}
+	if len(roots) != 1 || roots[0].File != "testdata/platform/root_darwin.go" {
+		t.Errorf("resolved roots %v, expected the darwin Root", roots)
+	}
+	// The findings of several platforms are united.
+	setFlag(t, &goosList, stringSlice{"linux", "darwin"})
+	c = newChecker(*dir, checkOptions{})
+	res, err = c.findings(context.Background(), strings.NewReader(patch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, h := range res.hunks {
+		files = append(files, filepath.Base(h.file))
+	}
+	if want := []string{"root_darwin.go", "root_linux.go"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("hunks of %v, expected %v", files, want)
+	}
+	out.Reset()
+	if code := listReachableFiles(context.Background(), out); code != exitOK {
+		t.Fatalf("-list-reachable-files exit code %d", code)
+	}
+	if got, want := out.String(), "testdata/platform/root_darwin.go\ntestdata/platform/root_linux.go\n"; got != want {
+		t.Errorf("reachable files\n%s\nexpected\n%s", got, want)
+	}
+	var b strings.Builder
+	if code := printChangedSymbols(context.Background(), &b, c, strings.NewReader(patch)); code != exitOK {
+		t.Fatalf("-changed-symbols exit code %d", code)
+	}
+	if got, want := b.String(), "github.com/orijtech/consensuswarn/testdata/platform.Root\n"; got != want {
+		t.Errorf("changed symbols %q, expected %q", got, want)
+	}
+	// The platform failing to load is named.
+	setFlag(t, &goosList, stringSlice{"linux", "windows"})
+	c = newChecker(*dir, checkOptions{})
+	if _, err := c.findings(context.Background(), strings.NewReader(patch)); err == nil || !strings.Contains(err.Error(), "GOOS=windows") {
+		t.Errorf("expected the windows load to fail, got %v", err)
+	}
+}
+
+func TestCheckRun(t *testing.T) {
+	f := newFakeGitHub(t, readFile(t, "testdata/state1.patch"))
+	setupRun(t)
+	setFlag(t, commentMode, "check-run")
+	if code := run(context.Background(), f.client(t, "")); code != exitOK {
+		t.Fatalf("exit code %d, expected %d", code, exitOK)
+	}
+	var runs []checkRun
+	for i, r := range f.requests {
+		if r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/repos/owner/repo/issues/") {
+			t.Errorf("unexpected request %s %s for comments", r.Method, r.URL.Path)
+		}
+		if r.Method != "POST" && r.Method != "PATCH" {
+			continue
+		}
+		if r.URL.Path != "/repos/owner/repo/check-runs" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			continue
+		}
+		var run checkRun
+		if err := json.Unmarshal([]byte(f.bodies[i]), &run); err != nil {
+			t.Fatal(err)
+		}
+		runs = append(runs, run)
+	}
+	if len(runs) != 1 {
+		t.Fatalf("expected 1 check run, got %d", len(runs))
+	}
+	r := runs[0]
+	if r.Name != "consensuswarn" || r.HeadSHA != "abcdef" || r.Status != "completed" || r.Conclusion != "failure" {
+		t.Errorf("check run %s of %s is %s with conclusion %s, expected consensuswarn of abcdef completed with failure", r.Name, r.HeadSHA, r.Status, r.Conclusion)
+	}
+	hunks := checkPatch(t, "testdata/state1.patch", rootNames...)
+	sortHunks(hunks)
+	var want []checkAnnotation
+	for _, h := range hunks {
+		// The annotations are on the lines at the head commit.
+		lines := headLines(h.hunk, cmp.Or(h.lastHunk, h.hunk))
+		want = append(want, checkAnnotation{
+			Path:            "testdata/state.go",
+			StartLine:       lines[0],
+			EndLine:         lines[1],
+			AnnotationLevel: "warning",
+			Title:           h.stack[0].fun.FullName(),
+		})
+	}
+	if len(want) != 2 {
+		t.Fatalf("expected 2 findings, got %d", len(want))
+	}
+	got := slices.Clone(r.Output.Annotations)
+	for i := range got {
+		// The message is the comment of the finding in plain text.
+		if i < len(hunks) && !strings.Contains(got[i].Message, hunks[i].stack[0].fun.FullName()) {
+			t.Errorf("annotation message %q lacks the root of finding %d", got[i].Message, i)
+		}
+		if strings.ContainsAny(got[i].Message, "`<") {
+			t.Errorf("annotation message %q contains markdown or markers", got[i].Message)
+		}
+		got[i].Message = ""
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("annotations\n%+v\nexpected\n%+v", got, want)
+	}
+
+	// Later checks of the commit create new check runs rather than
+	// adding to the annotations of earlier ones, and pass without
+	// findings.
+	f = newFakeGitHub(t, "")
+	if code := run(context.Background(), f.client(t, "")); code != exitOK {
+		t.Fatalf("exit code %d, expected %d", code, exitOK)
+	}
+	runs = nil
+	for i, r := range f.requests {
+		if r.Method == "PATCH" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if r.Method != "POST" {
+			continue
+		}
+		var run checkRun
+		if err := json.Unmarshal([]byte(f.bodies[i]), &run); err != nil {
+			t.Fatal(err)
+		}
+		runs = append(runs, run)
+	}
+	if len(runs) != 1 || runs[0].Conclusion != "success" || len(runs[0].Output.Annotations) != 0 {
+		t.Errorf("expected a new successful check run without annotations, got %+v", runs)
+	}
+}
+
+func TestPushCommit(t *testing.T) {
+	f := newFakeGitHub(t, "")
+	f.compareDiff = readFile(t, "testdata/state1.patch")
+	setupRun(t)
+	setFlag(t, &prNumbers, nil)
+	setFlag(t, pushCommit, "abcdef")
+	if code := run(context.Background(), f.client(t, "")); code != exitOK {
+		t.Fatalf("exit code %d, expected %d", code, exitOK)
+	}
+	var posted []github.RepositoryComment
+	for i, r := range f.requests {
+		if r.Method != "POST" {
+			continue
+		}
+		if r.URL.Path != "/repos/owner/repo/commits/abcdef/comments" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			continue
+		}
+		var c github.RepositoryComment
+		if err := json.Unmarshal([]byte(f.bodies[i]), &c); err != nil {
+			t.Fatal(err)
+		}
+		posted = append(posted, c)
+	}
+	// The findings are anchored at the last lines of the first and third
+	// hunks of the diff.
+	var got []string
+	for _, c := range posted {
+		got = append(got, fmt.Sprintf("%s:%d", c.GetPath(), c.GetPosition()))
+		if _, ok := commentFingerprint(c.GetBody()); !ok {
+			t.Errorf("comment lacks a fingerprint:\n%s", c.GetBody())
+		}
+	}
+	if want := []string{"testdata/state.go:7", "testdata/state.go:23"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("commit comments at %v, expected %v", got, want)
+	}
+
+	// The comments are not posted again.
+	data, err := json.Marshal(posted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.commitComments = string(data)
+	f.requests, f.bodies = nil, nil
+	if code := run(context.Background(), f.client(t, "")); code != exitOK {
+		t.Fatalf("exit code %d, expected %d", code, exitOK)
+	}
+	for _, r := range f.requests {
+		if r.Method != "GET" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}
+}
+
+func TestRootMessage(t *testing.T) {
+	dir := writeModule(t, map[string]string{"keeper/keeper.go": `package keeper
+
+var state int
+
+func DeliverTx() { set() }
+
+func Commit() { set(); bump() }
+
+func set() {
+	state = 1
+}
+
+func bump() {
+	state++
+}
+`})
+	const patch = `diff --git a/keeper/keeper.go b/keeper/keeper.go
+--- a/keeper/keeper.go
++++ b/keeper/keeper.go
+@@ -10,1 +10,1 @@
+-	state = 1
++	state = 2
+@@ -14,1 +14,1 @@
+-	state++
++	state += 2
+`
+	setFlag(t, &rootMessages, rootMessageFlag{})
+	for _, spec := range []string{
+		"example.com/m/keeper.DeliverTx=Change potentially affects gas.",
+		"example.com/m/keeper.Commit=Change potentially affects determinism.",
+	} {
+		if err := rootMessages.Set(spec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rootMessages.Set("example.com/m/keeper.Commit"); err == nil {
+		t.Error("expected an error for a root without a message")
+	}
+	roots := []string{"example.com/m/keeper.DeliverTx", "example.com/m/keeper.Commit"}
+	fset := new(token.FileSet)
+	opts, err := checkOptionsFromFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := runCheck(context.Background(), fset, dir, strings.NewReader(patch), roots, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.hunks) != 2 {
+		t.Fatalf("expected 2 state changing hunks, got %d", len(res.hunks))
+	}
+	// Both roots reach set and list their concerns; only Commit reaches
+	// bump.
+	want := []string{
+		"- Change potentially affects gas. (`example.com/m/keeper.DeliverTx`)\n- Change potentially affects determinism. (`example.com/m/keeper.Commit`)\n\nCall sequence:",
+		"Change potentially affects determinism.\n\nCall sequence:",
+	}
+	for i, h := range res.hunks {
+		if body := commentBody(fset, &h, 0); !strings.HasPrefix(body, want[i]) {
+			t.Errorf("comment on line %d:\n%s\nexpected to start with\n%s", h.startLine, body, want[i])
+		}
+	}
+	// The roots without a message keep the title of the comments.
+	delete(rootMessages, rootFunction{typ: "example.com/m/keeper", fun: "Commit"})
+	if body := commentBody(fset, &res.hunks[1], 0); !strings.HasPrefix(body, commentTitle+"\n") {
+		t.Errorf("comment on bump:\n%s\nexpected to start with the title of the comments", body)
+	}
+}
+
+func TestSkipNonGoPatch(t *testing.T) {
+	f := newFakeGitHub(t, `diff --git a/README.md b/README.md
+--- a/README.md
++++ b/README.md
+@@ -1,1 +1,1 @@
+-# consensuswarn
++# ConsensusWarn
+diff --git a/testdata/state_test.go b/testdata/state_test.go
+--- a/testdata/state_test.go
++++ b/testdata/state_test.go
+@@ -1,1 +1,1 @@
+-package testdata
++package testdata_test
+`)
+	setupRun(t)
+	setFlag(t, noComment, true)
+	setFlag(t, &loadProgram, func(ctx context.Context, fset *token.FileSet, dir string, roots []string, opts checkOptions) (*program, error) {
+		t.Error("unexpected load of the packages")
+		return load(ctx, fset, dir, roots, opts)
+	})
+	if code := run(context.Background(), f.client(t, "")); code != exitOK {
+		t.Fatalf("exit code %d, expected %d", code, exitOK)
+	}
+	// Test files are worth loading the packages for if they are reported.
+	setFlag(t, includeTests, true)
+	loads := 0
+	setFlag(t, &loadProgram, func(ctx context.Context, fset *token.FileSet, dir string, roots []string, opts checkOptions) (*program, error) {
+		loads++
+		return load(ctx, fset, dir, roots, opts)
+	})
+	if code := run(context.Background(), f.client(t, "")); code != exitOK {
+		t.Fatalf("exit code %d, expected %d", code, exitOK)
+	}
+	if loads != 1 {
+		t.Errorf("packages loaded %d times, expected once", loads)
+	}
+
+	// So are added Go files, which may be reached at the head.
+	setFlag(t, includeTests, false)
+	f.diffs["1"] = `diff --git a/testdata/added.go b/testdata/added.go
+new file mode 100644
+--- /dev/null
++++ b/testdata/added.go
+@@ -0,0 +1,1 @@
++package testdata
+`
+	loads = 0
+	if code := run(context.Background(), f.client(t, "")); code != exitOK {
+		t.Fatalf("exit code %d, expected %d", code, exitOK)
+	}
+	if loads != 1 {
+		t.Errorf("packages loaded %d times for an added file, expected once", loads)
+	}
+}
+
+func TestWASM(t *testing.T) {
+	setupRun(t)
+	setFlag(t, &rootNames, stringSlice{"github.com/orijtech/consensuswarn/testdata/wasm.Root"})
+	patch := readFile(t, "testdata/wasm.patch")
+	for _, goos := range wasmPlatforms {
+		// GOARCH=wasm is implied.
+		setFlag(t, &goosList, stringSlice{goos})
+		c := newChecker(*dir, checkOptions{})
+		res, err := c.findings(context.Background(), strings.NewReader(patch))
+		if err != nil {
+			t.Fatalf("GOOS=%s: %v", goos, err)
+		}
+		if len(res.hunks) != 1 || res.hunks[0].stack[len(res.hunks[0].stack)-1].fun.Name() != "set" {
+			t.Errorf("GOOS=%s: expected the hunk of set, got %v", goos, res.hunks)
+		}
+	}
+	// An explicit GOARCH is kept.
+	if env := withGOOS([]string{"GOARCH=amd64"}, "wasip1"); !reflect.DeepEqual(env, []string{"GOARCH=amd64", "GOOS=wasip1"}) {
+		t.Errorf("environment %q, expected GOARCH=amd64 to be kept", env)
+	}
+}
+
+func TestDisableRoots(t *testing.T) {
+	dir := writeModule(t, map[string]string{"keeper/keeper.go": `package keeper
+
+type Keeper struct {
+	a, b, c int
+}
+
+func (k *Keeper) A() {
+	k.a = 1
+}
+
+func (k *Keeper) B() {
+	k.b = 1
+}
+
+func (k *Keeper) C() {
+	k.c = 1
+}
+`})
+	const patch = `diff --git a/keeper/keeper.go b/keeper/keeper.go
+--- a/keeper/keeper.go
++++ b/keeper/keeper.go
+@@ -8,1 +8,1 @@
+-	k.a = 1
++	k.a = 2
+@@ -12,1 +12,1 @@
+-	k.b = 1
++	k.b = 2
+@@ -16,1 +16,1 @@
+-	k.c = 1
++	k.c = 2
+`
+	roots := []string{"example.com/m/keeper.Keeper.A", "example.com/m/keeper.Keeper.B", "example.com/m/keeper.Keeper.C"}
+	setFlag(t, &disabledRoots, stringSlice{"example.com/m/keeper.Keeper.B"})
+	opts, err := checkOptionsFromFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := runCheck(context.Background(), new(token.FileSet), dir, strings.NewReader(patch), roots, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []string
+	for _, h := range res.hunks {
+		found = append(found, h.stack[0].fun.Name())
+	}
+	if want := []string{"A", "C"}; !reflect.DeepEqual(found, want) {
+		t.Errorf("findings of the roots %v, expected %v", found, want)
+	}
+	if len(res.roots) != 2 {
+		t.Errorf("%d roots checked, expected 2", len(res.roots))
+	}
+	setFlag(t, &disabledRoots, stringSlice{"B"})
+	if _, err := checkOptionsFromFlags(); err == nil {
+		t.Error("expected an error for a malformed disabled root")
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// commentText is the wording of the posted comments in a language. The
+// fields ending in "f" are format strings.
+type commentText struct {
+	Title        string
+	CallSequence string
+	// NoFindings is the title of a check run without findings.
+	NoFindings string
+	// FramesOmittedf formats the number of frames omitted from a long call
+	// sequence.
+	FramesOmittedf string
+	Removes        string
+	// Globalsf formats the list of package-level variables written by a
+	// change.
+	Globalsf string
+	// Cgof formats the list of C functions called through cgo by the
+	// changed function.
+	Cgof string
+	// Ownersf formats the list of owners of the changed file.
+	Ownersf string
+	// FileColumns are the column headers of the per-file roll-up of the
+	// summary table.
+	FileColumns [3]string
+	// OwnersColumn is the column header of the owners of a file in the
+	// roll-up.
+	OwnersColumn string
+	// Columns are the column headers of the summary table.
+	Columns [5]string
+	// Framesf formats the number of frames of a call sequence in the
+	// summary table.
+	Framesf string
+}
+
+// languages are the bundled translations of the comments, by language tag.
+var languages = map[string]commentText{
+	"en": {
+		Title:          commentTitle,
+		CallSequence:   "Call sequence:",
+		NoFindings:     "No change affects state.",
+		FramesOmittedf: "... (%d frames omitted) ...",
+		Removes:        "The change removes consensus-relevant code.",
+		Globalsf:       "The change writes the package-level variables `%s`.",
+		Cgof:           "The changed function calls the C functions `%s` through cgo.",
+		Ownersf:        "Owners: %s",
+		FileColumns:    [3]string{"File", "Findings", "Roots"},
+		OwnersColumn:   "Owners",
+		Columns:        [5]string{"File", "Line", "Root", "Depth", "Call sequence"},
+		Framesf:        "%d frames",
+	},
+	"de": {
+		Title:          "Die Änderung betrifft möglicherweise den Zustand.",
+		CallSequence:   "Aufrufsequenz:",
+		NoFindings:     "Keine Änderung betrifft den Zustand.",
+		FramesOmittedf: "... (%d Aufrufe ausgelassen) ...",
+		Removes:        "Die Änderung entfernt konsensrelevanten Code.",
+		Globalsf:       "Die Änderung schreibt die Paketvariablen `%s`.",
+		Cgof:           "Die geänderte Funktion ruft die C-Funktionen `%s` über cgo auf.",
+		Ownersf:        "Zuständig: %s",
+		FileColumns:    [3]string{"Datei", "Befunde", "Wurzeln"},
+		OwnersColumn:   "Zuständig",
+		Columns:        [5]string{"Datei", "Zeile", "Wurzel", "Tiefe", "Aufrufsequenz"},
+		Framesf:        "%d Aufrufe",
+	},
+}
+
+// languageTags returns the sorted tags of the bundled languages.
+func languageTags() []string {
+	var tags []string
+	for tag := range languages {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// text returns the wording of the comments in the -lang language.
+func text() commentText {
+	return languages[*lang]
+}
+
+// commentMarker identifies the comments without a finding fingerprint posted
+// by consensuswarn, regardless of their language and title.
+const commentMarker = "<!-- consensuswarn -->"
+
+// fingerprintMarker matches the finding fingerprint embedded in comments.
+var fingerprintMarker = regexp.MustCompile(`<!-- consensuswarn:fingerprint=([0-9a-f]+) -->`)
+
+// commentFingerprint returns the finding fingerprint embedded in body, if
+// any.
+func commentFingerprint(body string) (string, bool) {
+	if m := fingerprintMarker.FindStringSubmatch(body); m != nil {
+		return m[1], true
+	}
+	return "", false
+}
+
+// isOwnComment reports whether body is the body of a comment posted by
+// consensuswarn. Comments from earlier versions, which lack the markers, are
+// recognized by their English title.
+func isOwnComment(body string) bool {
+	return strings.Contains(body, commentMarker) || fingerprintMarker.MatchString(body) || strings.Contains(body, commentTitle)
+}
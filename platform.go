@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/token"
+	"go/types"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// newChecker returns a checker of the packages of the roots in dir for the
+// -goos platforms. With a single platform, the packages are loaded for it;
+// with several, each patch is checked against the packages of every platform
+// in sequence and the findings are united.
+func newChecker(dir string, opts checkOptions) *checker {
+	c := &checker{fset: new(token.FileSet), dir: dir, opts: opts}
+	if len(goosList) == 1 {
+		c.opts.env = withGOOS(opts.env, goosList[0])
+		return c
+	}
+	for _, goos := range goosList {
+		v := &checker{fset: c.fset, dir: dir, opts: opts, goos: goos}
+		v.opts.env = withGOOS(opts.env, goos)
+		c.variants = append(c.variants, v)
+	}
+	return c
+}
+
+// wasmPlatforms are the platforms only supported with GOARCH=wasm.
+var wasmPlatforms = []string{"js", "wasip1"}
+
+// withGOOS returns env with GOOS set to goos. The last value wins, overriding
+// -env and the environment. The WebAssembly platforms also set GOARCH unless
+// env does.
+func withGOOS(env []string, goos string) []string {
+	env = append(slices.Clip(env), "GOOS="+goos)
+	if !slices.Contains(wasmPlatforms, goos) {
+		return env
+	}
+	for _, kv := range env {
+		if strings.HasPrefix(kv, "GOARCH=") {
+			return env
+		}
+	}
+	return append(env, "GOARCH=wasm")
+}
+
+// programs returns the loaded programs of c, one for each platform.
+func (c *checker) programs() []*program {
+	if len(c.variants) == 0 {
+		return []*program{c.prog}
+	}
+	var progs []*program
+	for _, v := range c.variants {
+		progs = append(progs, v.prog)
+	}
+	return progs
+}
+
+// variantFindings checks patch against each platform variant of c and unites
+// the findings.
+func (c *checker) variantFindings(ctx context.Context, patch io.Reader) (*checkResult, error) {
+	data, err := io.ReadAll(patch)
+	if err != nil {
+		return nil, err
+	}
+	var results []*checkResult
+	for _, v := range c.variants {
+		res, err := v.findings(ctx, bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("GOOS=%s: %w", v.goos, err)
+		}
+		results = append(results, res)
+	}
+	return unionResults(results), nil
+}
+
+// variantSymbols returns the changed symbols of patch in any platform variant
+// of c, sorted.
+func (c *checker) variantSymbols(patch io.Reader) ([]string, error) {
+	data, err := io.ReadAll(patch)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, v := range c.variants {
+		vnames, err := v.prog.changedSymbols(v.dir, bytes.NewReader(data), v.opts)
+		if err != nil {
+			return nil, fmt.Errorf("GOOS=%s: %w", v.goos, err)
+		}
+		names = append(names, vnames...)
+	}
+	sort.Strings(names)
+	return slices.Compact(names), nil
+}
+
+// hunkKey identifies a hunk across the results of checking the same patch
+// against different packages.
+type hunkKey struct {
+	file      string
+	startLine int
+}
+
+// unionResults unites the results of checking the same patch against the
+// packages of several platforms. A hunk reported by several results is
+// reported once, with the call sequence of the first; a hunk is only
+// unreached if no result reaches it.
+func unionResults(results []*checkResult) *checkResult {
+	u := &checkResult{}
+	reached := make(map[hunkKey]bool)
+	unionHunks := func(dst []Hunk, hunks []Hunk) []Hunk {
+		for _, h := range hunks {
+			k := hunkKey{h.file, h.startLine}
+			if !reached[k] {
+				reached[k] = true
+				dst = append(dst, h)
+			}
+		}
+		return dst
+	}
+	spots := make(map[blindSpot]bool)
+	for _, res := range results {
+		u.roots = appendNew(u.roots, res.roots...)
+		u.partial = u.partial || res.partial
+		u.hunks = unionHunks(u.hunks, res.hunks)
+		u.acknowledged = unionHunks(u.acknowledged, res.acknowledged)
+		for _, spot := range res.blindSpots {
+			if !spots[spot] {
+				spots[spot] = true
+				u.blindSpots = append(u.blindSpots, spot)
+			}
+		}
+		for root, funcs := range res.reachable {
+			if u.reachable == nil {
+				u.reachable = make(map[*types.Func]map[*types.Func][]*types.Func)
+			}
+			u.reachable[root] = funcs
+		}
+	}
+	for _, res := range results {
+		u.unreached = unionHunks(u.unreached, res.unreached)
+	}
+	sortHunks(u.hunks)
+	sortHunks(u.acknowledged)
+	sortHunks(u.unreached)
+	sort.SliceStable(u.blindSpots, func(i, j int) bool {
+		a, b := u.blindSpots[i].pos, u.blindSpots[j].pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Line < b.Line
+	})
+	return u
+}
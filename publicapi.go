@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"slices"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// publicRoots returns the exported functions of the packages of pkgs with the
+// paths of publicAPI, and the exported methods of their exported types, in
+// the order of their declarations. It is an error if a path of publicAPI is
+// not among pkgs.
+func (s *analyzerState) publicRoots(pkgs []*packages.Package, publicAPI []string) ([]*types.Func, error) {
+	var roots []*types.Func
+	found := make(map[string]bool)
+	for _, pkg := range pkgs {
+		if !slices.Contains(publicAPI, pkg.PkgPath) {
+			continue
+		}
+		found[pkg.PkgPath] = true
+		for _, f := range pkg.Syntax {
+			for _, decl := range f.Decls {
+				decl, ok := decl.(*ast.FuncDecl)
+				if !ok || decl.Body == nil {
+					continue
+				}
+				if fun, ok := pkg.TypesInfo.Defs[decl.Name].(*types.Func); ok && isPublic(fun) {
+					roots = append(roots, fun)
+				}
+			}
+		}
+	}
+	for _, path := range publicAPI {
+		if !found[path] {
+			return nil, fmt.Errorf("public API package %s not found", path)
+		}
+	}
+	return roots, nil
+}
+
+// isPublic reports whether f is an exported function or an exported method of
+// an exported type.
+func isPublic(f *types.Func) bool {
+	if !f.Exported() {
+		return false
+	}
+	recv := f.Type().(*types.Signature).Recv()
+	if recv == nil {
+		return true
+	}
+	t := recv.Type()
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	named, ok := t.(*types.Named)
+	return ok && named.Obj().Exported()
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"go/token"
+	"os"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// runPush checks the changes of the pushed -commit from its first parent with
+// c and reports the findings on the commit, for pushes without a pull
+// request. It returns the exit code of the process.
+func runPush(ctx context.Context, gh *github.Client, c *checker) int {
+	split := strings.SplitN(*repository, "/", 2)
+	owner, repo := split[0], split[1]
+	commit, _, err := gh.Repositories.GetCommit(ctx, owner, repo, *pushCommit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "consensuswarn: %v\n", err)
+		return exitError
+	}
+	if len(commit.Parents) == 0 {
+		fmt.Fprintf(os.Stderr, "consensuswarn: commit %s has no parent\n", *pushCommit)
+		return exitError
+	}
+	sha, parent := commit.GetSHA(), commit.Parents[0].GetSHA()
+	patch, err := getCompareDiff(ctx, gh, owner, repo, parent, sha)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "consensuswarn: %v\n", err)
+		return exitError
+	}
+	sourceCommit = parent
+	if *treeAtHead {
+		sourceCommit = sha
+	}
+	if *listSymbols {
+		return printChangedSymbols(ctx, os.Stdout, c, patch)
+	}
+	fset := c.fset
+	res, err := c.findings(ctx, patch)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "consensuswarn: %v\n", err)
+		return exitError
+	}
+	hunks := res.hunks
+	if *writeBase {
+		if err := writeBaseline(*baseline, hunks); err != nil {
+			fmt.Fprintf(os.Stderr, "consensuswarn: %v\n", err)
+			return exitError
+		}
+		return exitOK
+	}
+	if *noComment {
+		return printFindings(os.Stdout, fset, res)
+	}
+	if *commentMode == "check-run" {
+		err = postCheckRun(ctx, gh, owner, repo, sha, fset, hunks)
+	} else {
+		err = postCommitComments(ctx, gh, owner, repo, sha, fset, hunks)
+	}
+	if err != nil {
+		if isForbidden(err) {
+			fmt.Fprintf(os.Stderr, "consensuswarn: no permission to comment on commit %s, printing the findings instead: %v\n", sha, err)
+			return printFindings(os.Stdout, fset, res)
+		}
+		fmt.Fprintf(os.Stderr, "consensuswarn: %v\n", err)
+		return exitError
+	}
+	return findingsCode(len(hunks), true)
+}
+
+// postCommitComments posts the findings for hunks as comments on commit. In
+// the table mode, a single comment holds the summary table; otherwise, each
+// finding is commented at the last line of its hunk in the diff of the
+// commit. Comments that were already posted are updated or skipped.
+func postCommitComments(ctx context.Context, gh *github.Client, owner, repo, commit string, fset *token.FileSet, hunks []Hunk) error {
+	if len(hunks) == 0 {
+		return nil
+	}
+	var existing []*github.RepositoryComment
+	opt := &github.ListOptions{}
+	for {
+		comments, resp, err := gh.Repositories.ListCommitComments(ctx, owner, repo, commit, opt)
+		if err != nil {
+			return err
+		}
+		for _, comment := range comments {
+			if isOwnComment(comment.GetBody()) {
+				existing = append(existing, comment)
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	if *commentMode == "table" {
+		if len(existing) > 0 {
+			return nil
+		}
+		body := summaryTable(fset, hunks)
+		_, _, err := gh.Repositories.CreateComment(ctx, owner, repo, commit, &github.RepositoryComment{Body: &body})
+		return err
+	}
+	posted := make(map[string]*github.RepositoryComment)
+	for _, comment := range existing {
+		if fingerprint, ok := commentFingerprint(comment.GetBody()); ok {
+			posted[fingerprint] = comment
+		}
+	}
+	for _, hunk := range hunks {
+		body := postedCommentBody(fset, &hunk, *maxFrames)
+		if prev, ok := posted[hunk.fingerprint()]; ok {
+			if prev.GetBody() != body {
+				if _, _, err := gh.Repositories.UpdateComment(ctx, owner, repo, prev.GetID(), &github.RepositoryComment{Body: &body}); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		comment := &github.RepositoryComment{Body: &body, Path: github.String(hunk.relFile)}
+		if position := hunk.diffPosition(); position > 0 {
+			comment.Position = &position
+		}
+		if _, _, err := gh.Repositories.CreateComment(ctx, owner, repo, commit, comment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diffPosition returns the position of the last line of h in the diff of its
+// file, counted from the line below the first hunk header, which anchors
+// commit comments. Like review comments, those on merged findings are
+// anchored in the last hunk merged. It is 0 if the position is unknown.
+func (h *Hunk) diffPosition() int {
+	hunk := cmp.Or(h.lastHunk, h.hunk)
+	if hunk == nil || hunk.StartPosition == 0 {
+		return 0
+	}
+	lines := bytes.Count(hunk.Body, []byte("\n"))
+	if !bytes.HasSuffix(hunk.Body, []byte("\n")) {
+		lines++
+	}
+	return int(hunk.StartPosition) - 1 + lines
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// remapToHead translates the line numbers of the hunks of p, which refer to
+// the files at the base of the patch, to the files at its head in dir, for
+// trees checked out at the head of a PR. Each hunk starts at its first line
+// at the head, or, if it only removes lines, at the line they precede. The
+// lines of its changes are recounted from the body, so that added lines are
+// found at their own lines and removed lines at the line they precede. The
+// hunks of deleted files are dropped.
+func (p *Patch) remapToHead(dir string) {
+	hunks := (*p)[:0]
+	for _, h := range *p {
+		if h.headRelFile == "/dev/null" {
+			continue
+		}
+		// Hunks without lines at the head name the line before them.
+		start := int(h.hunk.NewStartLine)
+		if h.hunk.NewLines == 0 {
+			start++
+		}
+		h.startLine = start
+		h.endLine = start + int(h.hunk.NewLines)
+		h.relFile = h.headRelFile
+		h.file = filepath.Join(dir, h.headRelFile)
+		h.atHead = true
+		line := start
+		j := 0
+		for _, l := range strings.SplitAfter(string(h.hunk.Body), "\n") {
+			if l == "" {
+				continue
+			}
+			switch l[0] {
+			case ' ':
+				line++
+			case '-':
+				h.changes[j].line = line
+				j++
+			case '+':
+				h.changes[j].line = line
+				j++
+				line++
+			}
+		}
+		hunks = append(hunks, h)
+	}
+	// Renamed files may sort differently.
+	sortHunks(hunks)
+	*p = hunks
+}
+
+// inTree reports whether the changed line c of h is in the file on disk: the
+// removed lines of the base of the patch, or the added lines after
+// remapToHead.
+func (h *Hunk) inTree(c change) bool {
+	if h.atHead {
+		return c.op == '+'
+	}
+	return c.op == '-'
+}
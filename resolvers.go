@@ -0,0 +1,152 @@
+package main
+
+import (
+	"go/ast"
+	"go/types"
+)
+
+// A Resolver resolves the functions potentially called by a call expression,
+// as an extension point for the dispatch mechanisms of particular codebases.
+// The built-in resolvers follow direct calls, calls through interfaces, hooks
+// and //go:linkname directives, calls of tracked function values, including
+// the receivers of methods of function types, and functions passed as
+// arguments.
+type Resolver interface {
+	// Resolve returns the functions potentially called by call, which is
+	// type checked by info. Functions without a body in the loaded packages
+	// are not followed.
+	Resolve(call *ast.CallExpr, info *types.Info) []*types.Func
+}
+
+// ResolverFunc adapts a function to a Resolver.
+type ResolverFunc func(call *ast.CallExpr, info *types.Info) []*types.Func
+
+func (f ResolverFunc) Resolve(call *ast.CallExpr, info *types.Info) []*types.Func {
+	return f(call, info)
+}
+
+// registeredResolvers are the resolvers added by RegisterResolver.
+var registeredResolvers []Resolver
+
+// RegisterResolver adds r to the resolvers of every check, after the built-in
+// ones. As consensuswarn is a command, whose package cannot be imported, a
+// codebase registers its resolvers from the init function of a file that it
+// adds to the package when building its copy of consensuswarn.
+func RegisterResolver(r Resolver) {
+	registeredResolvers = append(registeredResolvers, r)
+}
+
+// builtinResolvers returns the resolvers of the calls followed by default.
+func (s *analyzerState) builtinResolvers() []Resolver {
+	return []Resolver{
+		ResolverFunc(directCallee),
+		ResolverFunc(s.interfaceCallees),
+		ResolverFunc(s.hookCallees),
+		ResolverFunc(s.linkedCallees),
+		ResolverFunc(s.valueCallees),
+		ResolverFunc(s.receiverCallees),
+		ResolverFunc(argumentCallees),
+	}
+}
+
+// directCallee resolves the statically called function or method.
+func directCallee(call *ast.CallExpr, info *types.Info) []*types.Func {
+	if f := calledFunc(info, call); f != nil {
+		return []*types.Func{f}
+	}
+	return nil
+}
+
+// interfaceCallees resolves calls through interfaces, including interfaces
+// embedded in structs, which may dispatch to any implementation. Calls
+// through unexported struct fields pinned to concrete types dispatch to the
+// methods of those types only.
+func (s *analyzerState) interfaceCallees(call *ast.CallExpr, info *types.Info) []*types.Func {
+	f := calledFunc(info, call)
+	if f == nil {
+		return nil
+	}
+	if pinned, ok := s.pinnedTypes[interfaceField(info, call)]; ok && types.IsInterface(f.Type().(*types.Signature).Recv().Type()) {
+		var impls []*types.Func
+		for _, t := range pinned {
+			obj, _, _ := types.LookupFieldOrMethod(t, false, f.Pkg(), f.Name())
+			if m, ok := obj.(*types.Func); ok {
+				impls = append(impls, m)
+			}
+		}
+		return impls
+	}
+	return s.implementations(f, receiverType(info, call))
+}
+
+// hookCallees resolves calls of hook extraction functions to the registered
+// hooks.
+func (s *analyzerState) hookCallees(call *ast.CallExpr, info *types.Info) []*types.Func {
+	if f := calledFunc(info, call); f != nil && len(s.hooks) > 0 {
+		return s.hooks[rootFunctionOf(f)]
+	}
+	return nil
+}
+
+// valueCallees resolves calls of struct fields, local variables and elements
+// of containers to the functions assigned to them.
+func (s *analyzerState) valueCallees(call *ast.CallExpr, info *types.Info) []*types.Func {
+	return s.funcValues(info, call.Fun)
+}
+
+// funcValues returns the functions assigned to the struct field, local
+// variable or element of a container denoted by e.
+func (s *analyzerState) funcValues(info *types.Info, e ast.Expr) []*types.Func {
+	if field := selectedField(info, e); field != nil {
+		return s.fieldFuncs[field]
+	} else if v := localFuncVar(info, e); v != nil {
+		return s.fieldFuncs[v]
+	} else if c := indexedContainer(info, e); c != nil {
+		return s.fieldFuncs[c]
+	}
+	return nil
+}
+
+// receiverCallees resolves calls of the methods of named function types to
+// the function values of their receivers, which the methods are assumed to
+// call, such as route in
+//
+//	type Handler func(Msg)
+//
+//	func (h Handler) ServeMsg(m Msg) { h(m) }
+//
+//	var h Handler = route
+//	h.ServeMsg(m)
+func (s *analyzerState) receiverCallees(call *ast.CallExpr, info *types.Info) []*types.Func {
+	sel, ok := ast.Unparen(call.Fun).(*ast.SelectorExpr)
+	if !ok {
+		return nil
+	}
+	selection, ok := info.Selections[sel]
+	if !ok || selection.Kind() != types.MethodVal {
+		return nil
+	}
+	recv := selection.Recv()
+	if ptr, ok := recv.(*types.Pointer); ok {
+		recv = ptr.Elem()
+	}
+	if _, ok := recv.Underlying().(*types.Signature); !ok {
+		return nil
+	}
+	if f := funcValue(info, sel.X); f != nil {
+		return []*types.Func{f}
+	}
+	return s.funcValues(info, sel.X)
+}
+
+// argumentCallees resolves the functions passed as arguments, such as
+// functional options, which are assumed to be called by the callee.
+func argumentCallees(call *ast.CallExpr, info *types.Info) []*types.Func {
+	var funcs []*types.Func
+	for _, arg := range call.Args {
+		if f := funcValue(info, arg); f != nil {
+			funcs = append(funcs, f)
+		}
+	}
+	return funcs
+}
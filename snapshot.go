@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines surrounding the changes of a
+// hunk.
+const diffContext = 3
+
+// diffTrees returns a unified diff of the Go files in oldDir that differ in
+// newDir. Files added in newDir are omitted, because they cannot touch
+// functions of oldDir.
+func diffTrees(oldDir, newDir string) ([]byte, error) {
+	patch := new(bytes.Buffer)
+	err := filepath.WalkDir(oldDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".go") {
+			return err
+		}
+		rel, err := filepath.Rel(oldDir, path)
+		if err != nil {
+			return err
+		}
+		oldData, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		newData, err := os.ReadFile(filepath.Join(newDir, rel))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if bytes.Equal(oldData, newData) {
+			return nil
+		}
+		name := filepath.ToSlash(rel)
+		a, b := quotePath("a/"+name), quotePath("b/"+name)
+		fmt.Fprintf(patch, "diff --git %s %s\n--- %s\n+++ %s\n", a, b, a, b)
+		writeHunks(patch, splitLines(oldData), splitLines(newData))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return patch.Bytes(), nil
+}
+
+// quotePath quotes path as git does if it contains a double quote, a
+// backslash, a control character or a non-ASCII byte.
+func quotePath(path string) string {
+	if !strings.ContainsFunc(path, func(r rune) bool {
+		return r == '"' || r == '\\' || r < ' ' || r >= 0x7f
+	}) {
+		return path
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; c {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\a':
+			b.WriteString(`\a`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\v':
+			b.WriteString(`\v`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if c < ' ' || c >= 0x7f {
+				fmt.Fprintf(&b, "\\%03o", c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// edit is an operation of an edit script. The op is ' ' for a line common to
+// both sides, '-' for a removed line and '+' for an added line.
+type edit struct {
+	op byte
+	// a and b are the line indices in the old and new text before the edit.
+	a, b int
+}
+
+// maxDiffEdits bounds the number of edits searched by diffLines, whose memory
+// grows with their square.
+const maxDiffEdits = 2000
+
+// diffLines returns the shortest edit script turning a into b, computed by
+// the algorithm of Myers, "An O(ND) Difference Algorithm and Its
+// Variations". Texts differing by more than maxDiffEdits lines, such as
+// regenerated files, are diffed as a removal of a followed by an addition of
+// b.
+func diffLines(a, b []string) []edit {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	// trace[d] holds the diagonals -d-1 to d+1 of v before step d, the
+	// only ones read back for that step.
+	var trace [][]int
+search:
+	for d := 0; ; d++ {
+		if d > maxDiffEdits {
+			return replaceLines(n, m)
+		}
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+	// Walk back through the trace to recover the script.
+	var edits []edit
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || k != d && v[d+k] < v[d+k+2] {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[d+1+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			edits = append(edits, edit{' ', x, y})
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			edits = append(edits, edit{'+', x, prevY})
+		} else {
+			edits = append(edits, edit{'-', prevX, y})
+		}
+		x, y = prevX, prevY
+	}
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+// replaceLines returns the edit script removing the n lines of a text and
+// adding the m lines of another.
+func replaceLines(n, m int) []edit {
+	edits := make([]edit, 0, n+m)
+	for x := 0; x < n; x++ {
+		edits = append(edits, edit{'-', x, 0})
+	}
+	for y := 0; y < m; y++ {
+		edits = append(edits, edit{'+', n, y})
+	}
+	return edits
+}
+
+// writeHunks writes the unified diff hunks turning a into b.
+func writeHunks(w *bytes.Buffer, a, b []string) {
+	edits := diffLines(a, b)
+	for i := 0; i < len(edits); {
+		if edits[i].op == ' ' {
+			i++
+			continue
+		}
+		// Extend the hunk while the next change is near enough for the
+		// contexts to overlap.
+		start := max(i-diffContext, 0)
+		end := i
+		for j := i; j < len(edits) && j <= end+2*diffContext; j++ {
+			if edits[j].op != ' ' {
+				end = j
+			}
+		}
+		stop := min(end+diffContext+1, len(edits))
+		var oldLines, newLines int
+		for _, e := range edits[start:stop] {
+			if e.op != '+' {
+				oldLines++
+			}
+			if e.op != '-' {
+				newLines++
+			}
+		}
+		oldStart, newStart := edits[start].a, edits[start].b
+		if oldLines > 0 {
+			oldStart++
+		}
+		if newLines > 0 {
+			newStart++
+		}
+		fmt.Fprintf(w, "@@ -%d,%d +%d,%d @@\n", oldStart, oldLines, newStart, newLines)
+		for _, e := range edits[start:stop] {
+			line := ""
+			if e.op == '+' {
+				line = b[e.b]
+			} else {
+				line = a[e.a]
+			}
+			fmt.Fprintf(w, "%c%s\n", e.op, line)
+		}
+		i = stop
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/token"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	a := strings.Split("a b c d e f g h i j k l m", " ")
+	b := strings.Split("a b x d e f g h i j k l y m z", " ")
+	buf := new(bytes.Buffer)
+	writeHunks(buf, a, b)
+	want := `@@ -1,6 +1,6 @@
+ a
+ b
+-c
++x
+ d
+ e
+ f
+@@ -10,4 +10,6 @@
+ j
+ k
+ l
++y
+ m
++z
+`
+	if got := buf.String(); got != want {
+		t.Errorf("diff\n%s\nexpected\n%s", got, want)
+	}
+}
+
+func TestDiffLinesReplaced(t *testing.T) {
+	// Texts differing in more lines than maxDiffEdits are diffed as a
+	// replacement.
+	var a, b []string
+	for i := 0; i < maxDiffEdits; i++ {
+		a = append(a, fmt.Sprintf("a%d", i))
+		b = append(b, fmt.Sprintf("b%d", i))
+	}
+	b = append(b, a[0])
+	edits := diffLines(a, b)
+	if len(edits) != len(a)+len(b) {
+		t.Fatalf("%d edits, expected %d", len(edits), len(a)+len(b))
+	}
+	for i, e := range edits {
+		want := edit{'-', i, 0}
+		if i >= len(a) {
+			want = edit{'+', len(a), i - len(a)}
+		}
+		if e != want {
+			t.Fatalf("edit %d is %+v, expected %+v", i, e, want)
+		}
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	const keeper = `package keeper
+
+var state int
+
+func Root() {
+	mutate()
+}
+
+/*
+Space to separate hunks.
+*/
+func mutate() {
+	state++
+}
+`
+	oldDir := writeModule(t, map[string]string{"keeper/keeper.go": keeper})
+	newDir := writeModule(t, map[string]string{"keeper/keeper.go": strings.Replace(keeper, "state++", "state += 2", 1)})
+	patch, err := diffTrees(oldDir, newDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := runCheck(context.Background(), new(token.FileSet), oldDir, bytes.NewReader(patch), []string{"example.com/m/keeper.Root"}, checkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.hunks) != 1 {
+		t.Fatalf("expected 1 state changing hunk, got %d\n%s", len(res.hunks), patch)
+	}
+	if got := res.hunks[0].stack[len(res.hunks[0].stack)-1].fun.Name(); got != "mutate" {
+		t.Errorf("hunk touches %s, expected mutate", got)
+	}
+}
+
+func TestSnapshotQuotedPaths(t *testing.T) {
+	const name = "keeper/é \"q\".go"
+	oldDir := writeModule(t, map[string]string{name: "package keeper\n\nvar state int\n"})
+	newDir := writeModule(t, map[string]string{name: "package keeper\n\nvar state int64\n"})
+	patch, err := diffTrees(oldDir, newDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := parsePatch(oldDir, bytes.NewReader(patch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p) != 1 {
+		t.Fatalf("expected 1 hunk, got %d\n%s", len(p), patch)
+	}
+	if want := filepath.Join(oldDir, filepath.FromSlash(name)); p[0].file != want {
+		t.Errorf("got file %q, expected %q", p[0].file, want)
+	}
+}
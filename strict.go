@@ -0,0 +1,128 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+)
+
+// blindSpot is a call on a path from a root that the analysis cannot resolve.
+type blindSpot struct {
+	pos     token.Position
+	relFile string
+	caller  *types.Func
+	reason  string
+}
+
+// blindSpots returns the unresolved calls in the visited functions declared
+// in dir, sorted by position.
+func (s *analyzerState) blindSpots(dir string, visited map[*types.Func]bool) []blindSpot {
+	var spots []blindSpot
+	for f := range visited {
+		inf := s.funcs[f]
+		rel, err := filepath.Rel(dir, s.fset.Position(inf.fun.Pos()).Filename)
+		if err != nil || !filepath.IsLocal(rel) {
+			continue
+		}
+		params := paramFuncs(inf.info, inf.fun)
+		ast.Inspect(inf.fun.Body, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			if v := localFuncVar(inf.info, call.Fun); v != nil && params[v] {
+				return true
+			}
+			reason := s.unresolved(inf.info, call)
+			if reason == "" {
+				return true
+			}
+			spots = append(spots, blindSpot{
+				pos:     s.fset.Position(call.Pos()),
+				relFile: filepath.ToSlash(rel),
+				caller:  f,
+				reason:  reason,
+			})
+			return true
+		})
+	}
+	sort.Slice(spots, func(i, j int) bool {
+		pi, pj := spots[i].pos, spots[j].pos
+		if pi.Filename != pj.Filename {
+			return pi.Filename < pj.Filename
+		}
+		return pi.Offset < pj.Offset
+	})
+	return spots
+}
+
+// paramFuncs returns the receiver and parameters of decl, and the variables
+// ranging over them, whose functions are resolved at the calls of decl: the
+// functions passed to it by argumentCallees, and the function values of its
+// receiver by receiverCallees.
+func paramFuncs(info *types.Info, decl *ast.FuncDecl) map[types.Object]bool {
+	params := make(map[types.Object]bool)
+	for _, list := range []*ast.FieldList{decl.Recv, decl.Type.Params} {
+		if list == nil {
+			continue
+		}
+		for _, field := range list.List {
+			for _, name := range field.Names {
+				params[info.Defs[name]] = true
+			}
+		}
+	}
+	ast.Inspect(decl.Body, func(n ast.Node) bool {
+		if r, ok := n.(*ast.RangeStmt); ok && r.Value != nil {
+			if id, ok := ast.Unparen(r.X).(*ast.Ident); ok && params[info.Uses[id]] {
+				if v, ok := r.Value.(*ast.Ident); ok {
+					params[info.Defs[v]] = true
+				}
+			}
+		}
+		return true
+	})
+	return params
+}
+
+// unresolved describes why the callees of call cannot be resolved, or returns
+// the empty string if they can.
+func (s *analyzerState) unresolved(info *types.Info, call *ast.CallExpr) string {
+	fun := ast.Unparen(call.Fun)
+	if tv, ok := info.Types[fun]; ok && (tv.IsType() || tv.IsBuiltin()) {
+		return ""
+	}
+	if _, ok := fun.(*ast.FuncLit); ok {
+		return ""
+	}
+	if f := calledFunc(info, call); f != nil {
+		if name := cgoName(f); name != "" {
+			return "cgo call of " + name
+		}
+		if f.Pkg() != nil && f.Pkg().Path() == "reflect" && (f.Name() == "Call" || f.Name() == "CallSlice") {
+			return "reflective call"
+		}
+		recv := f.Type().(*types.Signature).Recv()
+		if recv != nil && types.IsInterface(recv.Type()) && len(s.implementations(f, receiverType(info, call))) == 0 {
+			return "call of " + f.Name() + " through an interface without known implementations"
+		}
+		return ""
+	}
+	if field := selectedField(info, fun); field != nil && len(s.fieldFuncs[field]) > 0 {
+		return ""
+	}
+	if v := localFuncVar(info, fun); v != nil && len(s.fieldFuncs[v]) > 0 {
+		return ""
+	}
+	if c := indexedContainer(info, fun); c != nil && len(s.fieldFuncs[c]) > 0 {
+		return ""
+	}
+	for _, r := range s.resolvers {
+		if len(r.Resolve(call, info)) > 0 {
+			return ""
+		}
+	}
+	return "call of an untracked function value"
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"io"
+	"slices"
+)
+
+// changedSymbols returns the sorted full names of the functions and methods
+// of the loaded packages whose bodies are touched by a hunk of the patch
+// relative to dir, whether or not they are reachable from a root. A hunk
+// touches a body as in Patch.Mark, so the names are comparable with the
+// touched functions of the findings.
+func (prog *program) changedSymbols(dir string, patch io.Reader, opts checkOptions) ([]string, error) {
+	p, err := parsePatch(dir, patch)
+	if err != nil {
+		return nil, err
+	}
+	if opts.treeAtHead {
+		p.remapToHead(dir)
+	}
+	var names []string
+	for f, inf := range prog.state.funcs {
+		if inf.fun.Body == nil {
+			continue
+		}
+		start := prog.state.position(inf.fun.Body.Pos())
+		end := prog.state.position(inf.fun.Body.End())
+		for _, h := range p {
+			if h.file == start.Filename && h.startLine <= end.Line && start.Line <= h.endLine {
+				names = append(names, f.FullName())
+				break
+			}
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names), nil
+}
@@ -0,0 +1,47 @@
+package addr
+
+type Keeper struct {
+	n int
+}
+
+func Root() { // want root
+	var k Keeper
+	(&k).Commit()
+	p := &k
+	pp := &p
+	((*pp).Reset)()
+	(&(*(*pp))).Flush()
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (k *Keeper) Commit() { // want touched
+	k.n++
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (k *Keeper) Reset() { // want touched
+	k.n = 0
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (k Keeper) Flush() { // want touched
+	println(k.n)
+}
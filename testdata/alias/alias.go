@@ -0,0 +1,5 @@
+package alias
+
+import "github.com/orijtech/consensuswarn/testdata/alias/basekeeper"
+
+type Keeper = basekeeper.Keeper
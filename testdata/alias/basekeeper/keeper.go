@@ -0,0 +1,9 @@
+package basekeeper
+
+type Keeper struct {
+	value int
+}
+
+func (k *Keeper) Set(v int) { // want touched
+	k.value = v
+}
@@ -0,0 +1,33 @@
+package allow
+
+type Keeper struct {
+	fee   int
+	state int
+}
+
+func (k *Keeper) Root() {
+	k.setFee()
+	k.setState()
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (k *Keeper) setFee() {
+	k.fee = 1
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (k *Keeper) setState() {
+	k.state = 1
+}
@@ -0,0 +1,21 @@
+//go:build cgo
+
+package cgo
+
+// static int add(int a, int b) { return a + b; }
+import "C"
+
+func Root() {
+	update()
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func update() {
+	C.add(1, 2)
+}
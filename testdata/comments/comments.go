@@ -0,0 +1,60 @@
+package comments
+
+type State struct {
+	n int
+}
+
+func (s *State) Root() {
+	s.documented()
+	s.explained()
+	s.annotated()
+	s.changed()
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (s *State) documented() {
+	s.n++
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (s *State) explained() {
+	/*
+		The counter is reset
+		before every block.
+	*/
+	s.n = 0
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (s *State) annotated() {
+	s.n--
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (s *State) changed() {
+	s.n *= 2
+}
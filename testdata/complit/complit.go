@@ -0,0 +1,60 @@
+package complit
+
+type Handler struct {
+	OnCommit func()
+	OnAbort  func()
+}
+
+type Keeper struct {
+	handler Handler
+	flush   Flusher
+}
+
+type Flusher struct {
+	flush func()
+}
+
+func New() *Keeper {
+	k := new(Keeper)
+	k.handler = Handler{OnCommit: k.commit, OnAbort: k.abort}
+	k.flush = Flusher{k.flushAll}
+	return k
+}
+
+func Root(k *Keeper) { // want root
+	k.handler.OnCommit()
+	k.flush.flush()
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (k *Keeper) commit() { // want touched
+	println("commit")
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (k *Keeper) abort() {
+	println("abort")
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (k *Keeper) flushAll() { // want touched
+	println("flush")
+}
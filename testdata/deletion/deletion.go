@@ -0,0 +1,12 @@
+package deletion
+
+var state []int
+
+func Root() {
+	Mutate()
+}
+
+func Mutate() {
+	state = append(state, 1)
+	state = append(state, 2)
+}
@@ -0,0 +1,37 @@
+package edges
+
+func Root() { // want root
+	a()
+	b()
+}
+
+func a() { // want reachable
+	deep()
+	log()
+}
+
+func b() { // want reachable
+	log()
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func deep() {
+	println("deep")
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func log() { // want touched
+	println("log")
+}
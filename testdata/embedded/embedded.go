@@ -0,0 +1,47 @@
+package embedded
+
+type Reader interface {
+	Read()
+}
+
+type Writer interface {
+	Write()
+}
+
+type ReadWriter interface {
+	Reader
+	Writer
+}
+
+func Root(rw ReadWriter) { // want root
+	rw.Write()
+}
+
+type file struct{}
+
+func (f *file) Read() {
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (f *file) Write() { // want touched
+	println("file")
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+type sink struct{}
+
+func (s sink) Write() {
+	println("sink")
+}
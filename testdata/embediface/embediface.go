@@ -0,0 +1,37 @@
+package embediface
+
+type StateWriter interface {
+	Write()
+}
+
+type K struct {
+	StateWriter
+}
+
+func Root(k K) { // want root
+	k.Write()
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+type store struct{}
+
+func (s *store) Write() { // want touched
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+type other struct{}
+
+func (o *other) Read() {
+}
@@ -0,0 +1,39 @@
+package fieldfunc
+
+type Keeper struct {
+	commit   func(int)
+	rollback func()
+}
+
+func New() *Keeper {
+	k := new(Keeper)
+	k.commit = defaultCommit
+	k.rollback = defaultRollback
+	return k
+}
+
+func Root(k *Keeper) { // want root
+	k.commit(1)
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func defaultCommit(n int) { // want touched
+	println("commit", n)
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func defaultRollback() {
+	println("rollback")
+}
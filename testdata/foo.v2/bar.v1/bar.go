@@ -0,0 +1,9 @@
+package bar
+
+func Func() {
+}
+
+type Store struct{}
+
+func (s Store) Write() {
+}
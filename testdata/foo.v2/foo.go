@@ -0,0 +1,14 @@
+package foo
+
+import "github.com/orijtech/consensuswarn/testdata/foo.v2/bar.v1"
+
+func Func() {
+	bar.Func()
+}
+
+type Keeper struct{}
+
+func (k *Keeper) Commit() {
+	var b bar.Store
+	b.Write()
+}
@@ -0,0 +1,6 @@
+package forward
+
+// set is declared in a file loaded before the file of its caller.
+func (k *Keeper) set() { // want touched
+	k.state++
+}
@@ -0,0 +1,20 @@
+package forward
+
+func Root(k *Keeper) { // want root
+	mutate(k)
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func mutate(k *Keeper) { // want touched
+	k.set()
+}
+
+type Keeper struct {
+	state int
+}
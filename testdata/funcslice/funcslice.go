@@ -0,0 +1,68 @@
+package funcslice
+
+type Keeper struct {
+	n int
+}
+
+type Pipeline struct {
+	stages []func()
+}
+
+func (k *Keeper) Root() { // want root
+	var steps []func()
+	steps = append(steps, k.begin)
+	for _, step := range steps {
+		step()
+	}
+	hooks := map[string]func(){"end": k.end}
+	hooks["end"]()
+	var p Pipeline
+	p.stages = append(p.stages, k.finalize)
+	p.stages[0]()
+	unused := []func(){k.unused}
+	_ = unused
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (k *Keeper) begin() { // want touched
+	k.n = 1
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (k *Keeper) end() { // want touched
+	k.n = 2
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (k *Keeper) finalize() { // want touched
+	k.n = 3
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (k *Keeper) unused() {
+	k.n = 4
+}
@@ -0,0 +1,72 @@
+package functype
+
+type Msg struct {
+	n int
+}
+
+type Handler func(Msg)
+
+func (h Handler) ServeMsg(m Msg) { // want reachable
+	h(m)
+}
+
+type Router struct {
+	h Handler
+}
+
+func NewRouter() *Router {
+	return &Router{h: route}
+}
+
+var state int
+
+func (r *Router) Root(m Msg) { // want root
+	Handler(deliver).ServeMsg(m)
+	var h Handler = commit
+	h.ServeMsg(m)
+	r.h.ServeMsg(m)
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func deliver(m Msg) { // want touched
+	state = m.n
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func commit(m Msg) { // want touched
+	state *= m.n
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func route(m Msg) { // want touched
+	state += m.n
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func unused(m Msg) {
+	state -= m.n
+}
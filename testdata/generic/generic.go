@@ -0,0 +1,21 @@
+package generic
+
+type Collection[K comparable, V any] struct {
+	items map[K]V
+}
+
+func (c *Collection[K, V]) Set(k K, v V) { // want root
+	c.items[k] = v
+	record()
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func record() { // want touched
+	println("set")
+}
@@ -0,0 +1,34 @@
+package genericctor
+
+// Collection is a generic store, as in the collections package of the Cosmos
+// SDK.
+type Collection[K comparable, V any] struct {
+	items map[K]V
+}
+
+func NewCollection[K comparable, V any](items map[K]V) *Collection[K, V] { // want reachable
+	return &Collection[K, V]{items: items}
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (c *Collection[K, V]) Set(k K, v V) { // want touched
+	c.items[k] = v
+	println("set")
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func Root(items map[string]int) { // want root
+	NewCollection[string, int](items).Set("a", 1)
+}
@@ -0,0 +1,37 @@
+package globals
+
+var (
+	counter int
+	total   int
+	limits  = map[string]int{}
+)
+
+func Root() {
+	bump()
+	local()
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func bump() {
+	counter++
+	limits["bump"] = counter
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func local() {
+	counter := 0
+	counter++
+	println(counter)
+}
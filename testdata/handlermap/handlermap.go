@@ -0,0 +1,39 @@
+package handlermap
+
+type Handler interface {
+	Handle(msg string)
+}
+
+type Router struct {
+	handlers map[string]Handler
+}
+
+func (r *Router) Root(route, msg string) { // want root
+	r.handlers[route].Handle(msg)
+	if h, ok := r.handlers["fallback"]; ok {
+		h.Handle(msg)
+	}
+}
+
+type bank struct {
+	balance int
+}
+
+func (b *bank) Handle(msg string) { // want touched
+	b.balance++
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+type staking struct {
+	bonded int
+}
+
+func (s staking) Handle(msg string) { // want touched
+	s.bonded++
+}
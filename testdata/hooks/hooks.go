@@ -0,0 +1,35 @@
+package hooks
+
+import "context"
+
+type hookKey struct{}
+
+func SetHook(ctx context.Context, h func()) context.Context {
+	return context.WithValue(ctx, hookKey{}, h)
+}
+
+func GetHook(ctx context.Context) func() { // want reachable
+	h, _ := ctx.Value(hookKey{}).(func())
+	return h
+}
+
+func Setup(ctx context.Context) context.Context {
+	return SetHook(ctx, mutate)
+}
+
+func Root(ctx context.Context) { // want root
+	GetHook(ctx)()
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+var state int
+
+func mutate() { // want touched
+	state++
+}
@@ -0,0 +1,60 @@
+package hookslice
+
+type Hooks interface {
+	BeginBlock()
+	EndBlock()
+}
+
+type Manager struct {
+	hooks []Hooks
+}
+
+func (m *Manager) Root() { // want root
+	for _, h := range m.hooks {
+		h.BeginBlock()
+	}
+	for i := range m.hooks {
+		m.hooks[i].EndBlock()
+	}
+}
+
+type bank struct{}
+
+func (bank) BeginBlock() { // want touched
+	println("bank begin")
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (bank) EndBlock() { // want touched
+	println("bank end")
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+type staking struct{}
+
+func (s *staking) BeginBlock() { // want touched
+	println("staking begin")
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (s *staking) EndBlock() { // want touched
+	println("staking end")
+}
@@ -0,0 +1,32 @@
+package hunksize
+
+type State struct {
+	n int
+}
+
+func (s *State) Root() {
+	s.small()
+	s.large()
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (s *State) small() {
+	s.n++
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (s *State) large() {
+	s.n--
+}
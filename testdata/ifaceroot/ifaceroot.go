@@ -0,0 +1,34 @@
+package ifaceroot
+
+type StateWriter interface {
+	Write(key string)
+}
+
+type memory struct{}
+
+func (m memory) Write(key string) { // want touched
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+type disk struct{}
+
+func (d *disk) Write(key string) { // want touched
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+type log struct{}
+
+func (l *log) Write(n int) {
+}
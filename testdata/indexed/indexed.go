@@ -0,0 +1,26 @@
+package indexed
+
+type Store struct {
+	version int
+}
+
+type Keeper struct {
+	stores []Store
+}
+
+func (k *Keeper) Root() { // want root
+	for i := range k.stores {
+		k.stores[i].Commit()
+	}
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (s *Store) Commit() { // want touched
+	s.version++
+}
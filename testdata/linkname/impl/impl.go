@@ -0,0 +1,7 @@
+package impl
+
+var state int
+
+func setState(v int) { // want touched
+	state = v
+}
@@ -0,0 +1,15 @@
+package linkname
+
+import (
+	_ "unsafe"
+
+	// The linked package must be loaded.
+	_ "github.com/orijtech/consensuswarn/testdata/linkname/impl"
+)
+
+//go:linkname setState github.com/orijtech/consensuswarn/testdata/linkname/impl.setState
+func setState(v int)
+
+func Root() { // want root
+	setState(1)
+}
@@ -0,0 +1,34 @@
+package methodvalue
+
+type Keeper struct {
+	n int
+}
+
+func (k *Keeper) Root() { // want root
+	commit := k.Commit
+	defer commit()
+	var flush = k.flush
+	flush()
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (k *Keeper) Commit() { // want touched
+	k.n++
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (k *Keeper) flush() { // want touched
+	k.n = 0
+}
@@ -0,0 +1,38 @@
+package oncefunc
+
+var state []int
+
+func Root() { // want root
+	mutate()
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func mutate() { // want touched
+	state = append(state, 1)
+	/*
+
+
+
+	Space to separate hunks.
+
+
+
+	*/
+	state = append(state, 2)
+	/*
+
+
+
+	Space to separate hunks.
+
+
+
+	*/
+	state = append(state, 3)
+}
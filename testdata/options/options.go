@@ -0,0 +1,64 @@
+package options
+
+type Keeper struct {
+	store  int
+	limit  int
+	unused int
+}
+
+type Option func(*Keeper)
+
+func WithStore(s int) Option { // want reachable
+	return func(k *Keeper) {
+		k.setStore(s)
+	}
+}
+
+func WithDefaults(k *Keeper) { // want reachable
+	k.setLimit(10)
+}
+
+func New(opts ...Option) *Keeper { // want reachable
+	k := new(Keeper)
+	for _, o := range opts {
+		o(k)
+	}
+	return k
+}
+
+func Root() { // want root
+	New(WithStore(1), WithDefaults)
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (k *Keeper) setStore(s int) { // want touched
+	k.store = s
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (k *Keeper) setLimit(l int) { // want touched
+	k.limit = l
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (k *Keeper) setUnused(u int) {
+	k.unused = u
+}
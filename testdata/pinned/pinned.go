@@ -0,0 +1,49 @@
+package pinned
+
+type stateWriter interface {
+	Write()
+}
+
+// K embeds a stateWriter pinned to *store.
+type K struct {
+	stateWriter
+}
+
+// L holds a stateWriter pinned to *cache.
+type L struct {
+	w stateWriter
+}
+
+func NewK() K {
+	return K{stateWriter: &store{}}
+}
+
+func NewL() *L {
+	l := new(L)
+	l.w = &cache{}
+	return l
+}
+
+func Root(k K) { // want root
+	k.Write()
+}
+
+func (l *L) Root() { // want root
+	l.w.Write()
+}
+
+type store struct{}
+
+func (s *store) Write() { // want reachable
+}
+
+type cache struct{}
+
+func (c *cache) Write() { // want reachable
+}
+
+// disk implements stateWriter, but is never stored in K or L.
+type disk struct{}
+
+func (d *disk) Write() {
+}
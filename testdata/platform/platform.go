@@ -0,0 +1,3 @@
+package platform
+
+var state int
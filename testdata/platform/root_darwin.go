@@ -0,0 +1,5 @@
+package platform
+
+func Root() {
+	state = 2
+}
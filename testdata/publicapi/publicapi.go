@@ -0,0 +1,64 @@
+package publicapi
+
+func Transfer(amount int) {
+	move(amount)
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func move(amount int) {
+	println("move", amount)
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+type Bank struct{}
+
+func (Bank) Send(amount int) {
+	debit(amount)
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func debit(amount int) {
+	println("debit", amount)
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+type ledger struct{}
+
+func (ledger) Record(amount int) {
+	println("record", amount)
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func unused(amount int) {
+	println("unused", amount)
+}
@@ -0,0 +1,58 @@
+//go:build go1.23
+
+package rangefunc
+
+type Keeper struct {
+	items []int
+	sum   int
+}
+
+func (k *Keeper) Root() { // want root
+	for x := range k.Items {
+		k.apply(x)
+	}
+	for x := range k.Pending() {
+		k.apply(x)
+	}
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (k *Keeper) Items(yield func(int) bool) { // want touched
+	for _, x := range k.items {
+		k.sum += x
+		if !yield(x) {
+			return
+		}
+	}
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (k *Keeper) Pending() func(func(int) bool) { // want touched
+	return func(yield func(int) bool) {
+		k.sum = 0
+		yield(len(k.items))
+	}
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (k *Keeper) apply(x int) { // want touched
+	k.sum -= x
+}
@@ -0,0 +1,61 @@
+package recovery
+
+type State struct {
+	n int
+}
+
+func (s *State) Root() { // want root
+	defer func() {
+		if r := recover(); r != nil {
+			s.rollback()
+		}
+	}()
+	defer s.recoverPanic()
+	defer catch(s.reset)
+	panic("failed")
+}
+
+func catch(cleanup func()) { // want reachable
+	if recover() != nil {
+		cleanup()
+	}
+}
+
+func (s *State) recoverPanic() { // want reachable
+	if recover() != nil {
+		s.restore()
+	}
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (s *State) rollback() { // want touched
+	s.n = 0
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (s *State) restore() { // want touched
+	s.n = 1
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (s *State) reset() { // want touched
+	s.n = 2
+}
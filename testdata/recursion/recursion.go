@@ -0,0 +1,58 @@
+package recursion
+
+type State struct {
+	n int
+}
+
+func (s *State) Root() { // want root
+	s.even(10)
+}
+
+func (s *State) Other() { // want root
+	s.odd(3)
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (s *State) even(n int) { // want touched
+	if n == 0 {
+		return
+	}
+	s.n++
+	s.odd(n - 1)
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (s *State) odd(n int) { // want touched
+	if n == 0 {
+		s.count(n)
+		return
+	}
+	s.n--
+	s.even(n - 1)
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func (s *State) count(n int) { // want touched
+	if n > 0 {
+		s.count(n - 1)
+	}
+	s.n = n
+}
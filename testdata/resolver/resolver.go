@@ -0,0 +1,19 @@
+package resolver
+
+// dispatch calls the handler registered under name by a code generator.
+func dispatch(name string) { // want reachable
+}
+
+func Root() { // want root
+	dispatch("mutate")
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func mutate() { // want touched
+}
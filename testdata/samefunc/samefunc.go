@@ -0,0 +1,28 @@
+package samefunc
+
+var state []int
+
+func Root() { // want root
+	Mutate()
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func Mutate() { // want touched
+	state = append(state, 1)
+	/*
+
+
+
+	Space to separate hunks.
+
+
+
+	*/
+	state = append(state, 2)
+}
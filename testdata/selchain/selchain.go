@@ -0,0 +1,68 @@
+package selchain
+
+type Store struct{}
+
+func (*Store) Commit() { // want touched
+	println("commit")
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+type KV interface {
+	Set()
+}
+
+type kvStore struct{}
+
+func (kvStore) Set() { // want touched
+	println("set")
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+type Ledger struct{}
+
+func (*Ledger) Apply() { // want touched
+	println("apply")
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+type Stores struct {
+	main *Store
+	kv   KV
+	*Ledger
+}
+
+type App struct {
+	Stores
+}
+
+type Node struct {
+	app *App
+}
+
+func NewNode() *Node {
+	return &Node{app: &App{Stores{main: new(Store), kv: kvStore{}, Ledger: new(Ledger)}}}
+}
+
+func (n *Node) Root() { // want root
+	n.app.Stores.main.Commit()
+	n.app.kv.Set()
+	n.app.Apply()
+}
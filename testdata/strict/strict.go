@@ -0,0 +1,31 @@
+package strict
+
+import "reflect"
+
+type Store interface {
+	Write()
+}
+
+var handlers = map[string]func(){}
+
+func Root(s Store, name string, v reflect.Value) {
+	handlers[name]()
+	s.Write()
+	v.Call(nil)
+	resolved()
+	apply(resolved, resolved)
+	func() {}()
+	_ = int64(len(name))
+}
+
+func resolved() {
+}
+
+// apply calls the functions passed by its callers, which are followed at
+// the calls of apply.
+func apply(f func(), opts ...func()) {
+	f()
+	for _, o := range opts {
+		o()
+	}
+}
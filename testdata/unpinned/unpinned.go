@@ -0,0 +1,62 @@
+package unpinned
+
+type StateWriter interface {
+	Write()
+}
+
+// K holds an exported StateWriter, which importing packages may set to any
+// implementation.
+type K struct {
+	W StateWriter
+}
+
+func NewK() K {
+	return K{W: &store{}}
+}
+
+func (k K) Root() { // want root
+	k.W.Write()
+}
+
+type store struct{}
+
+func (s *store) Write() { // want reachable
+}
+
+type disk struct{}
+
+func (d *disk) Write() { // want reachable
+}
+
+type stateReader interface {
+	Read()
+}
+
+// L holds a stateReader that is also set through its address.
+type L struct {
+	r stateReader
+}
+
+func NewL() *L {
+	l := &L{r: &cache{}}
+	set(&l.r)
+	return l
+}
+
+func set(r *stateReader) {
+	*r = &file{}
+}
+
+func (l *L) Root() { // want root
+	l.r.Read()
+}
+
+type cache struct{}
+
+func (c *cache) Read() { // want reachable
+}
+
+type file struct{}
+
+func (f *file) Read() { // want reachable
+}
@@ -0,0 +1,9 @@
+//go:build wasip1 || js
+
+package wasm
+
+import "syscall"
+
+func Root() {
+	set(syscall.Getpid())
+}
@@ -0,0 +1,7 @@
+package wasm
+
+var state int
+
+func set(v int) {
+	state = v
+}
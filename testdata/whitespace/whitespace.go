@@ -0,0 +1,18 @@
+package whitespace
+
+var state int
+
+func Root() {
+	Mutate()
+}
+
+/*
+
+
+Space to separate hunks.
+
+
+*/
+func Mutate() {
+	state = state + 1
+}